@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 渲染任务类型：human_approve 创建的审批卡片
+const renderKindApprove = "approve"
+
+// 审批载荷的类型，决定页面上的展示方式
+const (
+	payloadCommand = "command" // 要执行的命令
+	payloadDiff    = "diff"    // 要应用的改动
+	payloadText    = "text"    // 其他说明文字
+)
+
+// 审批结果
+const (
+	approvalApproved = "approved" // 批准（可能经过用户编辑，见 edited）
+	approvalDenied   = "denied"   // 拒绝
+	approvalTimeout  = "timeout"  // 超时未审批，视为拒绝
+)
+
+// 审批任务只能通过审批接口响应
+var errApprovalTask = errors.New("approval task must be answered via /api/render-tasks/{id}/approval")
+
+// ApprovalRequest 审批卡片的内容，渲染任务的 summary 为要执行的操作
+type ApprovalRequest struct {
+	Payload     string `json:"payload"`     // 要执行的命令或改动
+	PayloadType string `json:"payloadType"` // command | diff | text
+	Risk        string `json:"risk"`        // 风险等级: low | medium | high
+}
+
+// ApprovalDecision 用户的审批结论，签名覆盖其中所有字段
+type ApprovalDecision struct {
+	ApprovalId      string    `json:"approvalId" jsonschema_description:"审批ID，即页面上的渲染任务ID"`
+	Decision        string    `json:"decision" jsonschema:"enum=approved,enum=denied,enum=timeout" jsonschema_description:"approved 批准；denied 拒绝；timeout 超时未审批，视为拒绝"`
+	Approved        bool      `json:"approved" jsonschema_description:"是否可以执行，只有 approved 时为 true"`
+	Edited          bool      `json:"edited" jsonschema_description:"用户是否编辑了载荷，编辑后必须执行 payload 而不是原来的内容"`
+	Action          string    `json:"action" jsonschema_description:"申请执行的操作"`
+	Risk            string    `json:"risk" jsonschema:"enum=low,enum=medium,enum=high" jsonschema_description:"申请时声明的风险等级"`
+	Payload         string    `json:"payload" jsonschema_description:"批准执行的载荷（用户编辑过时为编辑后的内容）"`
+	OriginalPayload string    `json:"originalPayload,omitempty" jsonschema_description:"用户编辑前的原始载荷，只在 edited 时返回"`
+	Comment         string    `json:"comment" jsonschema_description:"用户的审批意见"`
+	RequestedAt     time.Time `json:"requestedAt" jsonschema_description:"申请审批的时间"`
+	DecidedAt       time.Time `json:"decidedAt" jsonschema_description:"审批的时间"`
+	Channel         string    `json:"channel,omitempty" jsonschema_description:"审批的渠道，超时时不返回"`
+}
+
+// ApprovalResult human_approve 的结构化返回结果：审批结论及其签名
+type ApprovalResult struct {
+	ApprovalDecision
+	SignatureAlg string `json:"signatureAlg" jsonschema_description:"签名算法，固定为 HMAC-SHA256"`
+	Signature    string `json:"signature" jsonschema_description:"对除 signatureAlg / signature 之外所有字段的 JSON 的签名（十六进制），可通过 /api/approvals/verify 校验"`
+}
+
+// approvalSigner 审批结论的签名器
+type approvalSigner struct {
+	secret []byte
+}
+
+// 全局签名器，启动时按配置的 approval_secret 重新创建
+var globalSigner = newApprovalSigner("")
+
+// newApprovalSigner 创建签名器，secret 为空时生成随机密钥（签名只能由本进程校验）
+func newApprovalSigner(secret string) *approvalSigner {
+	if secret == "" {
+		secret = randomToken() + randomToken()
+	}
+	return &approvalSigner{secret: []byte(secret)}
+}
+
+// Sign 对审批结论签名
+func (s *approvalSigner) Sign(decision ApprovalDecision) ApprovalResult {
+	return ApprovalResult{
+		ApprovalDecision: decision,
+		SignatureAlg:     "HMAC-SHA256",
+		Signature:        hex.EncodeToString(s.mac(decision)),
+	}
+}
+
+// Verify 校验审批结论的签名
+func (s *approvalSigner) Verify(result ApprovalResult) bool {
+	signature, err := hex.DecodeString(result.Signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(signature, s.mac(result.ApprovalDecision))
+}
+
+func (s *approvalSigner) mac(decision ApprovalDecision) []byte {
+	data, _ := json.Marshal(decision)
+	h := hmac.New(sha256.New, s.secret)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// HumanApproveTool 定义危险操作的审批工具，说明文案使用指定语言
+func HumanApproveTool(locale string) mcp.Tool {
+	desc := func(key string) string { return globalI18n.Tool(locale, "human_approve."+key) }
+	return mcp.NewTool(
+		"human_approve",
+		mcp.WithDescription(globalI18n.Tool(locale, "human_approve")),
+		mcp.WithString("action", mcp.Required(), mcp.Description(desc("action"))),
+		mcp.WithString("payload", mcp.Description(desc("payload"))),
+		mcp.WithString("payloadType", mcp.Enum(payloadCommand, payloadDiff, payloadText), mcp.DefaultString(payloadCommand),
+			mcp.Description(desc("payloadType"))),
+		mcp.WithString("risk", mcp.Required(), mcp.Enum(riskLow, riskMedium, riskHigh), mcp.Description(desc("risk"))),
+		mcp.WithNumber("timeoutSeconds", mcp.Description(desc("timeoutSeconds"))),
+		mcp.WithOutputSchema[ApprovalResult](),
+	)
+}
+
+// humanApproveHandler 展示审批卡片并阻塞等待用户审批
+func humanApproveHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	ctx, release := activeCalls.track(ctx)
+	defer release()
+
+	action, err := req.RequireString("action")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	approval := &ApprovalRequest{
+		Payload:     req.GetString("payload", ""),
+		PayloadType: req.GetString("payloadType", payloadCommand),
+		Risk:        req.GetString("risk", ""),
+	}
+	switch approval.Risk {
+	case riskLow, riskMedium, riskHigh:
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("risk 不支持 %q（可选 low | medium | high）", approval.Risk)), nil
+	}
+	switch approval.PayloadType {
+	case payloadCommand, payloadDiff, payloadText:
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("payloadType 不支持 %q（可选 command | diff | text）", approval.PayloadType)), nil
+	}
+	timeout := appConfig.WaitTimeout
+	if secs := req.GetFloat("timeoutSeconds", 0); secs > 0 {
+		timeout = time.Duration(secs * float64(time.Second))
+	}
+
+	task := RenderTask{
+		Id:        uuid.NewString(),
+		Kind:      renderKindApprove,
+		Summary:   action,
+		SessionId: sessionIdFromContext(ctx),
+		CreatedAt: time.Now(),
+		Approval:  approval,
+	}
+	globalSessionManager.AddRenderTask(task)
+	defer globalSessionManager.RemoveRenderTask(task.Id)
+	debugLog("🛂 [Approval] 请求审批 | ID: %s | 风险: %s | 操作: %s", task.Id, approval.Risk, action)
+
+	var result ApprovalResult
+	response, err := globalSessionManager.WaitRenderTask(ctx, task.Id, timeout)
+	switch {
+	case err == nil && response.Approval != nil:
+		globalMetrics.ObserveWait("human_approve", waitAnswered, time.Since(task.CreatedAt))
+		result = *response.Approval
+	case errors.Is(err, errWaitTimeout):
+		debugLog("⌛ [Approval] 审批超时，视为拒绝 | ID: %s", task.Id)
+		globalMetrics.ObserveWait("human_approve", waitTimeout, time.Since(task.CreatedAt))
+		result = globalSigner.Sign(ApprovalDecision{
+			ApprovalId:  task.Id,
+			Decision:    approvalTimeout,
+			Action:      action,
+			Risk:        approval.Risk,
+			Payload:     approval.Payload,
+			RequestedAt: task.CreatedAt,
+			DecidedAt:   time.Now(),
+		})
+	case err != nil:
+		debugLog("🔌 [Approval] 调用已取消，停止等待 | %v", err)
+		globalMetrics.ObserveWait("human_approve", waitCancelled, time.Since(task.CreatedAt))
+		return nil, err
+	default:
+		return mcp.NewToolResultError("审批响应缺少审批结论"), nil
+	}
+	debugLog("✅ [Approval] 审批完成 | ID: %s | 结论: %s | 编辑: %t", task.Id, result.Decision, result.Edited)
+
+	locale := localeFromContext(ctx)
+	var text string
+	switch {
+	case result.Approved && result.Edited:
+		text = globalI18n.Prompt(locale, "approve_edited", InstructionData{Payload: result.Payload})
+	case result.Approved:
+		text = globalI18n.Prompt(locale, "approve_approved", InstructionData{})
+	case result.Decision == approvalTimeout:
+		text = globalI18n.Prompt(locale, "approve_timeout", InstructionData{})
+	default:
+		text = globalI18n.Prompt(locale, "approve_denied", InstructionData{})
+	}
+	if result.Comment != "" {
+		text += "\n\n" + globalI18n.Prompt(locale, "approve_comment", InstructionData{Comment: result.Comment})
+	}
+	data, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultStructured(result, text+"\n\n---\n\n"+string(data)), nil
+}
+
+// approvalRequest 页面提交的审批结论
+type approvalRequest struct {
+	Decision string  `json:"decision"` // approve | deny
+	Payload  *string `json:"payload"`  // 可选，编辑后的载荷，与原载荷不同时视为编辑后批准
+	Comment  string  `json:"comment"`  // 可选，审批意见
+}
+
+// handleApproveRenderTask 处理 POST /api/render-tasks/{id}/approval
+func handleApproveRenderTask(w http.ResponseWriter, r *http.Request) {
+	debugLog("🌐 [HTTP] %s %s | 审批AI渲染任务", r.Method, r.URL.Path)
+
+	var req approvalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Decision != "approve" && req.Decision != "deny" {
+		http.Error(w, "decision must be approve or deny", http.StatusBadRequest)
+		return
+	}
+
+	task, ok := globalSessionManager.GetRenderTask(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "No render task available", http.StatusNotFound)
+		return
+	}
+	if task.Kind != renderKindApprove {
+		http.Error(w, "render task is not an approval", http.StatusBadRequest)
+		return
+	}
+
+	decision := ApprovalDecision{
+		ApprovalId:  task.Id,
+		Decision:    approvalDenied,
+		Action:      task.Summary,
+		Risk:        task.Approval.Risk,
+		Payload:     task.Approval.Payload,
+		Comment:     req.Comment,
+		RequestedAt: task.CreatedAt,
+		DecidedAt:   time.Now(),
+		Channel:     channelWeb,
+	}
+	if req.Decision == "approve" {
+		decision.Decision = approvalApproved
+		decision.Approved = true
+		if req.Payload != nil && *req.Payload != task.Approval.Payload {
+			decision.Edited = true
+			decision.Payload = *req.Payload
+			decision.OriginalPayload = task.Approval.Payload
+		}
+	}
+	result := globalSigner.Sign(decision)
+
+	// 先移除渲染任务占位，避免同一个审批被重复响应
+	if !globalSessionManager.RemoveRenderTask(task.Id) {
+		http.Error(w, "No render task available", http.StatusNotFound)
+		return
+	}
+
+	locale := sessionLocale(task.SessionId)
+	summary := globalI18n.Text(locale, "record.denied", "action", task.Summary)
+	if decision.Approved {
+		summary = globalI18n.Text(locale, "record.approved", "action", task.Summary)
+	}
+	// 对渲染任务的回答不受队列容量限制
+	taskId, _ := globalSessionManager.PushResponse(UserChoiceResponse{
+		CustomInput:   summary,
+		Continue:      true,
+		SelectedIndex: -1,
+		SessionId:     task.SessionId,
+		RenderTaskId:  task.Id,
+		Note:          req.Comment,
+		Channel:       channelWeb,
+		Approval:      &result,
+	})
+	// 审批不会产生新的工作，直接标记为完成
+	globalSessionManager.Taskmng.UpdateTask(taskId, "completed", globalI18n.Text(locale, "record.approval", "decision", decision.Decision))
+	debugLog("✅ [Approval] 页面已审批 | ID: %s | TaskID: %s | 结论: %s | 编辑: %t", task.Id, taskId, decision.Decision, decision.Edited)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":       "success",
+		"message":      "Approval sent",
+		"taskId":       taskId,
+		"renderTaskId": task.Id,
+		"decision":     decision.Decision,
+	})
+}
+
+// handleVerifyApproval 处理 POST /api/approvals/verify，校验 human_approve 返回的审批结论签名
+func handleVerifyApproval(w http.ResponseWriter, r *http.Request) {
+	var result ApprovalResult
+	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	valid := globalSigner.Verify(result)
+	debugLog("🌐 [HTTP] %s %s | 校验审批签名 | ID: %s | 有效: %t", r.Method, r.URL.Path, result.ApprovalId, valid)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"valid":    valid,
+		"approved": valid && result.Approved,
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testDecision() ApprovalDecision {
+	requested := time.Now()
+	return ApprovalDecision{
+		ApprovalId:      "render-1",
+		Decision:        "approved",
+		Approved:        true,
+		Edited:          true,
+		Action:          "drop table",
+		Risk:            "high",
+		Payload:         "DROP TABLE tmp_users;",
+		OriginalPayload: "DROP TABLE users;",
+		Comment:         "只删临时表",
+		RequestedAt:     requested,
+		DecidedAt:       requested.Add(3 * time.Second),
+		Channel:         channelWeb,
+	}
+}
+
+func TestApprovalSignVerify(t *testing.T) {
+	signer := newApprovalSigner("secret")
+	result := signer.Sign(testDecision())
+	if result.SignatureAlg != "HMAC-SHA256" || result.Signature == "" {
+		t.Fatalf("Sign = %s/%q, want an HMAC-SHA256 signature", result.SignatureAlg, result.Signature)
+	}
+	if !signer.Verify(result) {
+		t.Fatalf("Verify of a freshly signed result = false")
+	}
+	if !newApprovalSigner("secret").Verify(result) {
+		t.Errorf("Verify with the same secret in another signer = false")
+	}
+	if newApprovalSigner("other").Verify(result) {
+		t.Errorf("Verify with a different secret = true")
+	}
+	// 未配置密钥时每个签名器生成自己的随机密钥
+	if newApprovalSigner("").Verify(newApprovalSigner("").Sign(testDecision())) {
+		t.Errorf("random secrets verified each other's signature")
+	}
+
+	// 签名覆盖所有字段，修改任何一个都校验失败
+	tampers := map[string]func(*ApprovalResult){
+		"decision":  func(r *ApprovalResult) { r.Decision = "denied" },
+		"approved":  func(r *ApprovalResult) { r.Approved = false },
+		"payload":   func(r *ApprovalResult) { r.Payload = "DROP TABLE users;" },
+		"comment":   func(r *ApprovalResult) { r.Comment = "" },
+		"decidedAt": func(r *ApprovalResult) { r.DecidedAt = r.DecidedAt.Add(time.Second) },
+		"signature": func(r *ApprovalResult) { r.Signature = r.Signature[:len(r.Signature)-2] + "00" },
+		"not hex":   func(r *ApprovalResult) { r.Signature = "zz" },
+	}
+	for name, tamper := range tampers {
+		tampered := result
+		tamper(&tampered)
+		if signer.Verify(tampered) {
+			t.Errorf("Verify after changing %s = true", name)
+		}
+	}
+}
+
+func TestVerifyApprovalEndpoint(t *testing.T) {
+	prevSigner := globalSigner
+	globalSigner = newApprovalSigner("secret")
+	t.Cleanup(func() { globalSigner = prevSigner })
+
+	verify := func(result ApprovalResult) map[string]bool {
+		t.Helper()
+		// 经过 JSON 往返后签名仍然有效，AI 可以把收到的结果原样提交校验
+		body, _ := json.Marshal(result)
+		rec := httptest.NewRecorder()
+		handleVerifyApproval(rec, httptest.NewRequest(http.MethodPost, "/api/approvals/verify", bytes.NewReader(body)))
+		var got map[string]bool
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("invalid response %q: %v", rec.Body, err)
+		}
+		return got
+	}
+
+	result := globalSigner.Sign(testDecision())
+	if got := verify(result); !got["valid"] || !got["approved"] {
+		t.Errorf("verify signed approval = %v, want valid and approved", got)
+	}
+	result.Approved = false
+	result.Decision = "denied"
+	if got := verify(result); got["valid"] || got["approved"] {
+		t.Errorf("verify tampered approval = %v, want invalid and not approved", got)
+	}
+	denied := testDecision()
+	denied.Decision, denied.Approved = "denied", false
+	if got := verify(globalSigner.Sign(denied)); !got["valid"] || got["approved"] {
+		t.Errorf("verify signed denial = %v, want valid and not approved", got)
+	}
+}
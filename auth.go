@@ -0,0 +1,245 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"html/template"
+	"io/fs"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 登录会话有效期
+const sessionTTL = 7 * 24 * time.Hour
+
+// CSRF 令牌请求头
+const csrfHeader = "X-CSRF-Token"
+
+// authManager 任务管理页面和 REST API 的认证与 CSRF 防护
+//
+// 认证方式：
+//   - Authorization: Bearer <token>，供脚本调用，不需要 CSRF 令牌
+//   - /login 页面输入令牌后下发的会话 Cookie，供浏览器使用
+//
+// 未配置 auth_token 时不做认证（配置校验保证此时只能监听回环地址），但浏览器发起的写请求仍然要校验 CSRF
+type authManager struct {
+	token     string
+	cookieTag string // Cookie 名后缀，同一台机器上多个实例端口不同，避免互相覆盖
+	loginTmpl *template.Template
+
+	mu       sync.Mutex
+	sessions map[string]time.Time // 会话ID -> 过期时间
+}
+
+func newAuthManager(token, addr string, files fs.FS) *authManager {
+	_, port, _ := net.SplitHostPort(addr)
+	return &authManager{
+		token:     token,
+		cookieTag: port,
+		loginTmpl: template.Must(template.ParseFS(files, "login.tmpl")),
+		sessions:  make(map[string]time.Time),
+	}
+}
+
+func (a *authManager) sessionCookie() string { return "human_in_mcp_session_" + a.cookieTag }
+func (a *authManager) csrfCookie() string    { return "human_in_mcp_csrf_" + a.cookieTag }
+
+// Wrap 为处理器加上认证和 CSRF 校验
+func (a *authManager) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		csrf := a.ensureCSRFCookie(w, r)
+		// Cookie 名与端口相关，经过反向代理时页面无法推断，所以同时通过响应头告知页面（同源才能读取）
+		w.Header().Set(csrfHeader, csrf)
+
+		switch r.URL.Path {
+		case "/login":
+			a.handleLogin(w, r, csrf)
+			return
+		case "/logout":
+			a.handleLogout(w, r, csrf)
+			return
+		}
+
+		viaBearer := false
+		if a.token != "" {
+			switch {
+			case a.checkBearer(r):
+				viaBearer = true
+			case a.checkSession(r):
+			default:
+				debugLog("🔒 [Auth] 未认证的请求 | %s %s", r.Method, r.URL.Path)
+				if strings.HasPrefix(r.URL.Path, "/api/") {
+					w.Header().Set("WWW-Authenticate", `Bearer realm="human-in-mcp"`)
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				} else {
+					http.Redirect(w, r, "/login", http.StatusSeeOther)
+				}
+				return
+			}
+		}
+
+		if !viaBearer && isMutating(r.Method) && strings.HasPrefix(r.URL.Path, "/api/") && !a.checkCSRF(r, csrf) {
+			debugLog("🛡️  [Auth] CSRF 校验失败 | %s %s | Origin: %s", r.Method, r.URL.Path, r.Header.Get("Origin"))
+			http.Error(w, "CSRF token mismatch", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkBearer 校验 Authorization: Bearer 令牌
+func (a *authManager) checkBearer(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	return ok && a.tokenMatches(token)
+}
+
+// checkSession 校验会话 Cookie
+func (a *authManager) checkSession(r *http.Request) bool {
+	cookie, err := r.Cookie(a.sessionCookie())
+	if err != nil {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	expires, ok := a.sessions[cookie.Value]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expires) {
+		delete(a.sessions, cookie.Value)
+		return false
+	}
+	return true
+}
+
+// checkCSRF 校验写请求的 CSRF 令牌（双重提交：请求头必须与 Cookie 一致）
+// 未开启认证时，既没有 Origin 也没有 Sec-Fetch-Site 的请求来自非浏览器客户端（如 curl），直接放行
+func (a *authManager) checkCSRF(r *http.Request, csrf string) bool {
+	if header := r.Header.Get(csrfHeader); header != "" {
+		return subtle.ConstantTimeCompare([]byte(header), []byte(csrf)) == 1
+	}
+	return a.token == "" && r.Header.Get("Origin") == "" && r.Header.Get("Sec-Fetch-Site") == ""
+}
+
+func (a *authManager) tokenMatches(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+// ensureCSRFCookie 返回当前的 CSRF 令牌，没有时生成并下发
+func (a *authManager) ensureCSRFCookie(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(a.csrfCookie()); err == nil && len(cookie.Value) == 32 {
+		return cookie.Value
+	}
+	csrf := randomToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     a.csrfCookie(),
+		Value:    csrf,
+		Path:     "/",
+		SameSite: http.SameSiteStrictMode,
+	})
+	return csrf
+}
+
+// handleLogin GET 显示登录页，POST 校验令牌并下发会话 Cookie
+func (a *authManager) handleLogin(w http.ResponseWriter, r *http.Request, csrf string) {
+	if a.token == "" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.renderLogin(w, csrf, "", http.StatusOK)
+	case http.MethodPost:
+		if subtle.ConstantTimeCompare([]byte(r.PostFormValue("csrf")), []byte(csrf)) != 1 {
+			a.renderLogin(w, csrf, "页面已过期，请重试", http.StatusForbidden)
+			return
+		}
+		if !a.tokenMatches(r.PostFormValue("token")) {
+			debugLog("🔒 [Auth] 登录失败 | 来源: %s", r.RemoteAddr)
+			a.renderLogin(w, csrf, "访问令牌错误", http.StatusUnauthorized)
+			return
+		}
+
+		sessionId := randomToken()
+		a.mu.Lock()
+		a.sessions[sessionId] = time.Now().Add(sessionTTL)
+		a.mu.Unlock()
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     a.sessionCookie(),
+			Value:    sessionId,
+			Path:     "/",
+			MaxAge:   int(sessionTTL.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		debugLog("🔓 [Auth] 登录成功 | 来源: %s", r.RemoteAddr)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleLogout 注销当前会话
+func (a *authManager) handleLogout(w http.ResponseWriter, r *http.Request, csrf string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.checkCSRF(r, csrf) {
+		http.Error(w, "CSRF token mismatch", http.StatusForbidden)
+		return
+	}
+
+	if cookie, err := r.Cookie(a.sessionCookie()); err == nil {
+		a.mu.Lock()
+		delete(a.sessions, cookie.Value)
+		a.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: a.sessionCookie(), Value: "", Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *authManager) renderLogin(w http.ResponseWriter, csrf, errMsg string, status int) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	a.loginTmpl.Execute(w, map[string]string{"CSRF": csrf, "Error": errMsg})
+}
+
+// isMutating 是否是会修改状态的请求方法
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// randomToken 生成128位随机十六进制字符串
+func randomToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// isLoopbackAddr 监听地址是否只绑定在回环接口上
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config 服务配置
+// 优先级（从低到高）：内置默认值 < 配置文件 < 环境变量 < 命令行参数
+type Config struct {
+	Transport      string        `yaml:"transport"`       // MCP 传输方式: stdio | sse | http
+	MCPAddr        string        `yaml:"mcp_addr"`        // MCP 服务监听地址（sse / http）
+	UIAddr         string        `yaml:"ui_addr"`         // 任务管理页面监听地址
+	UIDir          string        `yaml:"ui_dir"`          // 任务管理页面资源目录，为空时使用内嵌资源
+	Debug          bool          `yaml:"debug"`           // 是否输出debug日志
+	LogPath        string        `yaml:"log_path"`        // debug日志文件路径
+	StorePath      string        `yaml:"store_path"`      // 持久化文件路径，memory 表示不持久化
+	QueueCapacity  int           `yaml:"queue_capacity"`  // 每个响应队列最多排队的指令数，0 表示不限制
+	Format         string        `yaml:"format"`          // 格式化模板（text/template），兼容旧的 %s 格式
+	Locale         string        `yaml:"locale"`          // 默认语言（zh | en），返回给AI的提示、工具说明和页面文案都使用该语言
+	PromptsDir     string        `yaml:"prompts_dir"`     // 自定义文案目录，其中的 <locale>.yaml 逐条覆盖内置文案
+	WaitTimeout    time.Duration `yaml:"wait_timeout"`    // 等待用户响应的默认超时，0 表示一直等待
+	OnTimeout      string        `yaml:"on_timeout"`      // 超时后的兜底行为: wait | stop
+	AuthToken      string        `yaml:"auth_token"`      // 任务管理页面和 REST API 的访问令牌，为空时不认证（只允许监听回环地址）
+	Elicitation    bool          `yaml:"elicitation"`     // 客户端支持时同时通过 MCP elicitation 在客户端界面上请求回答
+	ApprovalSecret string        `yaml:"approval_secret"` // human_approve 审批结论的签名密钥，为空时每次启动随机生成
+}
+
+// 默认配置文件路径，存在时自动加载
+const defaultConfigPath = "human_in_mcp.yaml"
+
+// 全局配置，main 中加载完成后只读
+var appConfig = DefaultConfig()
+
+// DefaultConfig 内置默认配置
+func DefaultConfig() *Config {
+	return &Config{
+		Transport:     transportSSE,
+		MCPAddr:       "localhost:8093",
+		UIAddr:        "127.0.0.1:8094",
+		LogPath:       "human_in_mcp_debug.log",
+		StorePath:     "human_in_mcp_data.jsonl",
+		QueueCapacity: 200,
+		Format:        "{{.Input}}",
+		Locale:        baseLocale,
+		OnTimeout:     onTimeoutWait,
+	}
+}
+
+// LoadConfig 按优先级合并默认值、配置文件、环境变量和命令行参数，并校验结果
+func LoadConfig(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("human_in_mcp", flag.ContinueOnError)
+	configPath := fs.String("config", "", "配置文件路径（YAML），也可通过 HUMAN_IN_MCP_CONFIG 指定，默认 "+defaultConfigPath)
+	flagCfg := DefaultConfig()
+	fs.StringVar(&flagCfg.Transport, "transport", flagCfg.Transport, "MCP 传输方式: stdio | sse | http")
+	fs.StringVar(&flagCfg.MCPAddr, "mcp-addr", flagCfg.MCPAddr, "MCP 服务监听地址")
+	fs.StringVar(&flagCfg.UIAddr, "ui-addr", flagCfg.UIAddr, "任务管理页面监听地址")
+	fs.StringVar(&flagCfg.UIDir, "ui-dir", flagCfg.UIDir, "任务管理页面资源目录（本地开发用，修改后页面自动刷新），为空时使用内嵌资源")
+	fs.BoolVar(&flagCfg.Debug, "debug", flagCfg.Debug, "输出debug日志")
+	fs.StringVar(&flagCfg.LogPath, "log", flagCfg.LogPath, "debug日志文件路径")
+	fs.StringVar(&flagCfg.StorePath, "store", flagCfg.StorePath, "持久化文件路径，memory 表示不持久化")
+	fs.IntVar(&flagCfg.QueueCapacity, "queue-capacity", flagCfg.QueueCapacity, "每个响应队列最多排队的指令数，0 表示不限制")
+	fs.StringVar(&flagCfg.Format, "format", flagCfg.Format, "格式化模板（text/template），兼容旧的 %s 格式")
+	fs.StringVar(&flagCfg.Locale, "locale", flagCfg.Locale, "默认语言: zh | en（MCP 客户端可以通过 ?locale= 为单个会话指定）")
+	fs.StringVar(&flagCfg.PromptsDir, "prompts-dir", flagCfg.PromptsDir, "自定义文案目录，其中的 <locale>.yaml 逐条覆盖内置文案")
+	fs.DurationVar(&flagCfg.WaitTimeout, "wait-timeout", flagCfg.WaitTimeout, "等待用户响应的默认超时，0 表示一直等待")
+	fs.StringVar(&flagCfg.OnTimeout, "on-timeout", flagCfg.OnTimeout, "超时后的兜底行为: wait | stop")
+	fs.StringVar(&flagCfg.AuthToken, "auth-token", flagCfg.AuthToken, "任务管理页面和 REST API 的访问令牌，监听非回环地址时必须设置")
+	fs.BoolVar(&flagCfg.Elicitation, "elicitation", flagCfg.Elicitation, "客户端支持时同时通过 MCP elicitation 在客户端界面上请求回答")
+	fs.StringVar(&flagCfg.ApprovalSecret, "approval-secret", flagCfg.ApprovalSecret, "human_approve 审批结论的签名密钥，为空时每次启动随机生成")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := DefaultConfig()
+
+	// 配置文件：显式指定时必须存在，默认路径不存在则跳过
+	path := *configPath
+	if path == "" {
+		path = os.Getenv("HUMAN_IN_MCP_CONFIG")
+	}
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigPath
+	}
+	if err := cfg.loadFile(path, explicit); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	// 命令行参数：只覆盖显式传入的参数
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "transport":
+			cfg.Transport = flagCfg.Transport
+		case "mcp-addr":
+			cfg.MCPAddr = flagCfg.MCPAddr
+		case "ui-addr":
+			cfg.UIAddr = flagCfg.UIAddr
+		case "ui-dir":
+			cfg.UIDir = flagCfg.UIDir
+		case "debug":
+			cfg.Debug = flagCfg.Debug
+		case "log":
+			cfg.LogPath = flagCfg.LogPath
+		case "store":
+			cfg.StorePath = flagCfg.StorePath
+		case "queue-capacity":
+			cfg.QueueCapacity = flagCfg.QueueCapacity
+		case "format":
+			cfg.Format = flagCfg.Format
+		case "locale":
+			cfg.Locale = flagCfg.Locale
+		case "prompts-dir":
+			cfg.PromptsDir = flagCfg.PromptsDir
+		case "wait-timeout":
+			cfg.WaitTimeout = flagCfg.WaitTimeout
+		case "on-timeout":
+			cfg.OnTimeout = flagCfg.OnTimeout
+		case "auth-token":
+			cfg.AuthToken = flagCfg.AuthToken
+		case "elicitation":
+			cfg.Elicitation = flagCfg.Elicitation
+		case "approval-secret":
+			cfg.ApprovalSecret = flagCfg.ApprovalSecret
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile 从YAML文件加载配置，文件中未出现的字段保持原值
+func (c *Config) loadFile(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			return nil
+		}
+		return fmt.Errorf("读取配置文件失败: %v", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+	}
+	return nil
+}
+
+// loadEnv 从 HUMAN_IN_MCP_* 环境变量加载配置
+func (c *Config) loadEnv() error {
+	envs := []struct {
+		key string
+		set func(v string) error
+	}{
+		{"HUMAN_IN_MCP_TRANSPORT", func(v string) error { c.Transport = v; return nil }},
+		{"HUMAN_IN_MCP_MCP_ADDR", func(v string) error { c.MCPAddr = v; return nil }},
+		{"HUMAN_IN_MCP_UI_ADDR", func(v string) error { c.UIAddr = v; return nil }},
+		{"HUMAN_IN_MCP_UI_DIR", func(v string) error { c.UIDir = v; return nil }},
+		{"HUMAN_IN_MCP_DEBUG", func(v string) (err error) { c.Debug, err = strconv.ParseBool(v); return }},
+		{"HUMAN_IN_MCP_LOG", func(v string) error { c.LogPath = v; return nil }},
+		{"HUMAN_IN_MCP_STORE", func(v string) error { c.StorePath = v; return nil }},
+		{"HUMAN_IN_MCP_QUEUE_CAPACITY", func(v string) (err error) { c.QueueCapacity, err = strconv.Atoi(v); return }},
+		{"HUMAN_IN_MCP_FORMAT", func(v string) error { c.Format = v; return nil }},
+		{"HUMAN_IN_MCP_LOCALE", func(v string) error { c.Locale = v; return nil }},
+		{"HUMAN_IN_MCP_PROMPTS_DIR", func(v string) error { c.PromptsDir = v; return nil }},
+		{"HUMAN_IN_MCP_WAIT_TIMEOUT", func(v string) (err error) { c.WaitTimeout, err = time.ParseDuration(v); return }},
+		{"HUMAN_IN_MCP_ON_TIMEOUT", func(v string) error { c.OnTimeout = v; return nil }},
+		{"HUMAN_IN_MCP_AUTH_TOKEN", func(v string) error { c.AuthToken = v; return nil }},
+		{"HUMAN_IN_MCP_ELICITATION", func(v string) (err error) { c.Elicitation, err = strconv.ParseBool(v); return }},
+		{"HUMAN_IN_MCP_APPROVAL_SECRET", func(v string) error { c.ApprovalSecret = v; return nil }},
+	}
+
+	for _, env := range envs {
+		v := os.Getenv(env.key)
+		if v == "" {
+			continue
+		}
+		if err := env.set(v); err != nil {
+			return fmt.Errorf("环境变量 %s 格式错误: %v", env.key, err)
+		}
+	}
+	return nil
+}
+
+// Validate 校验配置，返回第一个发现的错误
+func (c *Config) Validate() error {
+	switch c.Transport {
+	case transportStdio, transportSSE, transportHTTP:
+	default:
+		return fmt.Errorf("transport 不支持 %q（可选 stdio | sse | http）", c.Transport)
+	}
+	if c.Transport != transportStdio {
+		if _, _, err := net.SplitHostPort(c.MCPAddr); err != nil {
+			return fmt.Errorf("mcp_addr 格式错误: %v", err)
+		}
+	}
+	if _, _, err := net.SplitHostPort(c.UIAddr); err != nil {
+		return fmt.Errorf("ui_addr 格式错误: %v", err)
+	}
+	if c.AuthToken == "" && !isLoopbackAddr(c.UIAddr) {
+		return fmt.Errorf("ui_addr %s 不是回环地址，必须设置 auth_token", c.UIAddr)
+	}
+	if c.Transport != transportStdio && c.MCPAddr == c.UIAddr {
+		return fmt.Errorf("mcp_addr 和 ui_addr 不能相同: %s", c.MCPAddr)
+	}
+	if c.UIDir != "" {
+		// 页面和登录页都从 ui_dir 读取，缺少任何一个都无法提供服务
+		for _, name := range []string{"index.html", "login.tmpl"} {
+			if _, err := os.Stat(filepath.Join(c.UIDir, name)); err != nil {
+				return fmt.Errorf("ui_dir 中找不到 %s: %v", name, err)
+			}
+		}
+	}
+	if c.Debug && c.LogPath == "" {
+		return fmt.Errorf("debug 开启时 log_path 不能为空")
+	}
+	if c.StorePath == "" {
+		return fmt.Errorf("store_path 不能为空（不需要持久化时设为 memory）")
+	}
+	if c.QueueCapacity < 0 {
+		return fmt.Errorf("queue_capacity 不能为负数，当前为 %d", c.QueueCapacity)
+	}
+	if _, err := parsePrompt(c.Format); err != nil {
+		return fmt.Errorf("format 无效: %v", err)
+	}
+	if _, err := LoadI18n(c.PromptsDir, c.Locale); err != nil {
+		return fmt.Errorf("locale / prompts_dir 无效: %v", err)
+	}
+	if c.WaitTimeout < 0 {
+		return fmt.Errorf("wait_timeout 不能为负数")
+	}
+	switch c.OnTimeout {
+	case onTimeoutWait, onTimeoutStop:
+	default:
+		return fmt.Errorf("on_timeout 不支持 %q（可选 wait | stop）", c.OnTimeout)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// connectionInfo MCP 客户端在连接地址（或请求头）上携带的参数
+type connectionInfo struct {
+	Locale  string `json:"locale,omitempty"`  // ?locale=en 或 X-Locale 请求头
+	Project string `json:"project,omitempty"` // ?project=name 或 X-Project 请求头，用于选择项目的默认模板
+}
+
+// connectionKey 请求中携带的连接参数在 context 中的键
+type connectionKey struct{}
+
+// sessionConnections 会话ID → 建立会话时携带的连接参数
+var sessionConnections sync.Map
+
+// withConnection 读取 MCP 请求中的连接参数，保存到 context
+// SSE 传输下建立会话的 GET 请求和之后的工具调用是不同的请求，会话注册时把参数记到 sessionConnections
+func withConnection(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := connectionInfo{
+			Locale:  r.URL.Query().Get("locale"),
+			Project: r.URL.Query().Get("project"),
+		}
+		if info.Locale == "" {
+			info.Locale = r.Header.Get("X-Locale")
+		}
+		if info.Project == "" {
+			info.Project = r.Header.Get("X-Project")
+		}
+		if info != (connectionInfo{}) {
+			info.Locale = normalizeLocale(info.Locale)
+			r = r.WithContext(context.WithValue(r.Context(), connectionKey{}, info))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// connectionFromContext 返回当前调用的连接参数：请求携带的优先，没有时使用会话建立时携带的
+func connectionFromContext(ctx context.Context) connectionInfo {
+	if info, ok := ctx.Value(connectionKey{}).(connectionInfo); ok {
+		return info
+	}
+	return sessionConnection(sessionIdFromContext(ctx))
+}
+
+// sessionConnection 返回会话建立时携带的连接参数
+func sessionConnection(sessionId string) connectionInfo {
+	if info, ok := sessionConnections.Load(sessionId); ok {
+		return info.(connectionInfo)
+	}
+	return connectionInfo{}
+}
+
+// registerSession 会话建立时记录连接参数
+// 工具说明默认使用配置的语言，会话指定了其他语言时为该会话单独注册对应语言的各个工具和资源
+func registerSession(ctx context.Context, mcpServer *server.MCPServer, session server.ClientSession) {
+	info, _ := ctx.Value(connectionKey{}).(connectionInfo)
+	if info.Locale != "" {
+		info.Locale = globalI18n.Resolve(info.Locale)
+	}
+	sessionConnections.Store(session.SessionID(), info)
+	debugLog("🔗 [Session] 会话已建立 | 会话: %s | 语言: %s | 项目: %s", session.SessionID(), info.Locale, info.Project)
+	if info.Locale == "" || info.Locale == globalI18n.fallback {
+		return
+	}
+	err := mcpServer.AddSessionTools(session.SessionID(),
+		server.ServerTool{Tool: HumanInTool(info.Locale), Handler: humanInteractionHandler},
+		server.ServerTool{Tool: HumanAskTool(info.Locale), Handler: humanAskHandler},
+		server.ServerTool{Tool: HumanCheckTool(info.Locale), Handler: humanCheckHandler},
+		server.ServerTool{Tool: HumanApproveTool(info.Locale), Handler: humanApproveHandler},
+	)
+	if err != nil {
+		debugLog("⚠️  [Session] 注册会话工具失败 | 会话: %s | %v", session.SessionID(), err)
+	}
+	resources, templates := localizedResources(info.Locale)
+	if err := mcpServer.AddSessionResources(session.SessionID(), resources...); err != nil {
+		debugLog("⚠️  [Session] 注册会话资源失败 | 会话: %s | %v", session.SessionID(), err)
+	}
+	if err := mcpServer.AddSessionResourceTemplates(session.SessionID(), templates...); err != nil {
+		debugLog("⚠️  [Session] 注册会话资源模板失败 | 会话: %s | %v", session.SessionID(), err)
+	}
+}
+
+// unregisterSession 会话结束时清理连接参数、会话的默认模板和调用计数
+func unregisterSession(sessionId string) {
+	sessionConnections.Delete(sessionId)
+	globalTemplates.ClearSession(sessionId)
+	globalMetrics.ForgetSession(sessionId)
+}
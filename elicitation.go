@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// elicitationSession 返回支持 elicitation 的客户端会话
+// 需要传输层支持（stdio / http），并且客户端在初始化时声明了 elicitation 能力
+func elicitationSession(ctx context.Context) (server.SessionWithElicitation, bool) {
+	session := server.ClientSessionFromContext(ctx)
+	elicitation, ok := session.(server.SessionWithElicitation)
+	if !ok {
+		return nil, false
+	}
+	if info, ok := session.(server.SessionWithClientInfo); ok && info.GetClientCapabilities().Elicitation == nil {
+		return nil, false
+	}
+	return elicitation, true
+}
+
+// startElicitation 通过 MCP elicitation 在客户端界面上请求用户回答，与任务管理页面同时等待
+// 两边谁先响应谁生效，另一边的响应会因为渲染任务已被移除而失效；返回的函数用于停止等待
+func startElicitation(ctx context.Context, task RenderTask) (stop func()) {
+	if !appConfig.Elicitation {
+		return func() {}
+	}
+	session, ok := elicitationSession(ctx)
+	if !ok {
+		debugLog("ℹ️  [Elicitation] 客户端不支持 elicitation，只通过页面等待 | 渲染任务: %s", task.Id)
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		debugLog("💬 [Elicitation] 请求客户端回答 | 渲染任务: %s", task.Id)
+		result, err := session.RequestElicitation(ctx, elicitationRequest(localeFromContext(ctx), task))
+		if err != nil {
+			if ctx.Err() == nil {
+				debugLog("❌ [Elicitation] 请求失败，继续通过页面等待 | 渲染任务: %s | %v", task.Id, err)
+			}
+			return
+		}
+		if result.Action != mcp.ElicitationResponseActionAccept {
+			debugLog("🙅 [Elicitation] 用户在客户端拒绝回答，继续通过页面等待 | 渲染任务: %s | %s", task.Id, result.Action)
+			return
+		}
+
+		req, ok := elicitationAnswer(task, result.Content)
+		if !ok {
+			debugLog("⚠️  [Elicitation] 回答为空，继续通过页面等待 | 渲染任务: %s", task.Id)
+			return
+		}
+		if _, _, err := answerRenderTask(req, channelElicitation); err != nil {
+			if errors.Is(err, errRenderTaskGone) {
+				debugLog("ℹ️  [Elicitation] 渲染任务已通过其他渠道响应，忽略客户端回答 | 渲染任务: %s", task.Id)
+			} else {
+				debugLog("❌ [Elicitation] 客户端回答无效 | 渲染任务: %s | %v", task.Id, err)
+			}
+		}
+	}()
+	return cancel
+}
+
+// elicitationRequest 构建 elicitation 请求，请求的结构只能包含基本类型的字段，字段说明使用指定语言
+func elicitationRequest(locale string, task RenderTask) mcp.ElicitationRequest {
+	var message strings.Builder
+	message.WriteString(task.Summary)
+	if task.Difficulties != "" && task.Difficulties != "无" {
+		fmt.Fprintf(&message, "\n\n⚠️ %s", task.Difficulties)
+	}
+	for i, opt := range task.NextOptions {
+		fmt.Fprintf(&message, "\n[%d] %s", i+1, opt.Label)
+		if opt.Description != "" {
+			fmt.Fprintf(&message, " - %s", opt.Description)
+		}
+	}
+
+	properties := map[string]any{
+		"instruction": map[string]any{
+			"type":        "string",
+			"title":       globalI18n.Text(locale, "elicitation.instruction"),
+			"description": globalI18n.Text(locale, "elicitation.instructionHelp"),
+		},
+		"continue": map[string]any{
+			"type":        "boolean",
+			"title":       globalI18n.Text(locale, "elicitation.continue"),
+			"description": globalI18n.Text(locale, "elicitation.continueHelp"),
+			"default":     true,
+		},
+	}
+	if len(task.NextOptions) > 0 {
+		option := map[string]any{
+			"type":  "string",
+			"title": globalI18n.Text(locale, "elicitation.option"),
+			"enum":  optionLabels(task.NextOptions),
+		}
+		for _, opt := range task.NextOptions {
+			if opt.Default {
+				option["default"] = opt.Label
+			}
+		}
+		properties["option"] = option
+	}
+
+	return mcp.ElicitationRequest{
+		Params: mcp.ElicitationParams{
+			Message: message.String(),
+			RequestedSchema: map[string]any{
+				"type":       "object",
+				"properties": properties,
+			},
+		},
+	}
+}
+
+// elicitationAnswer 把客户端的回答转换为渲染任务响应请求，没有任何有效内容时返回 false
+func elicitationAnswer(task RenderTask, content any) (renderSelectRequest, bool) {
+	req := renderSelectRequest{RenderTaskId: task.Id, Continue: true}
+	values, _ := content.(map[string]any)
+
+	if cont, ok := values["continue"].(bool); ok {
+		req.Continue = cont
+	}
+	req.CustomInput, _ = values["instruction"].(string)
+	if label, _ := values["option"].(string); label != "" {
+		for i, opt := range task.NextOptions {
+			if opt.Label == label {
+				req.SelectedIndices = []int{i}
+				break
+			}
+		}
+	}
+
+	if req.Continue && len(req.SelectedIndices) == 0 && strings.TrimSpace(req.CustomInput) == "" {
+		return req, false
+	}
+	return req, true
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 推送给web页面的事件类型
+const (
+	EventRenderTaskCreated = "render-task-created"
+	EventRenderTaskRemoved = "render-task-removed"
+	EventTaskStatusChanged = "task-status-changed"
+	EventFormatChanged     = "format-changed"
+	EventTemplatesChanged  = "templates-changed" // 模板库或默认模板被修改
+	EventQueueDrained      = "queue-drained"
+	EventResponseAdded     = "response-added" // 新增了一条用户响应（历史决策）
+	EventUIReload          = "ui-reload"      // ui_dir 开发模式下页面资源被修改
+	EventResync            = "resync"         // 客户端请求的事件已不在回放缓冲中，需要全量刷新
+)
+
+// Event 推送给web页面的事件
+type Event struct {
+	Id   int64  `json:"id"`
+	Type string `json:"type"`
+	Data any    `json:"data"`
+	Time int64  `json:"time"`
+}
+
+// EventBroker 事件广播器，保留最近的事件用于断线重连后的 Last-Event-ID 回放
+type EventBroker struct {
+	mu          sync.Mutex
+	nextId      int64
+	history     []Event
+	historySize int
+	subscribers map[chan Event]struct{}
+}
+
+func NewEventBroker(historySize int) *EventBroker {
+	return &EventBroker{
+		history:     make([]Event, 0, historySize),
+		historySize: historySize,
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// 全局事件广播器
+var globalEvents = NewEventBroker(500)
+
+// Publish 广播事件，订阅者消费过慢时直接断开，由客户端重连后回放
+func (b *EventBroker) Publish(eventType string, data any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextId++
+	event := Event{Id: b.nextId, Type: eventType, Data: data, Time: time.Now().UnixMilli()}
+	if len(b.history) >= b.historySize {
+		b.history = append(b.history[:0], b.history[1:]...)
+	}
+	b.history = append(b.history, event)
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+			debugLog("⚠️  [Events] 订阅者消费过慢，已断开")
+		}
+	}
+}
+
+// Subscribe 订阅事件，返回 lastEventId 之后需要回放的事件
+// resync 为 true 表示缓冲中已经找不到 lastEventId 之后的全部事件
+func (b *EventBroker) Subscribe(lastEventId int64) (ch chan Event, replay []Event, resync bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch = make(chan Event, 64)
+	b.subscribers[ch] = struct{}{}
+
+	if lastEventId <= 0 {
+		return ch, nil, false
+	}
+	if len(b.history) > 0 && b.history[0].Id > lastEventId+1 || lastEventId > b.nextId {
+		return ch, nil, true
+	}
+	for _, event := range b.history {
+		if event.Id > lastEventId {
+			replay = append(replay, event)
+		}
+	}
+	return ch, replay, false
+}
+
+// Unsubscribe 取消订阅
+func (b *EventBroker) Unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// writeEvent 按 SSE 格式写出一个事件
+func writeEvent(w http.ResponseWriter, event Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	if event.Id > 0 {
+		fmt.Fprintf(w, "id: %d\n", event.Id)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
+
+// handleEvents 处理 GET /api/events，以 Server-Sent Events 推送实时变更
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// 浏览器重连时通过 Last-Event-ID 头携带，手动重连时通过 lastEventId 查询参数携带
+	lastId := r.Header.Get("Last-Event-ID")
+	if lastId == "" {
+		lastId = r.URL.Query().Get("lastEventId")
+	}
+	lastEventId, _ := strconv.ParseInt(lastId, 10, 64)
+
+	ch, replay, resync := globalEvents.Subscribe(lastEventId)
+	defer globalEvents.Unsubscribe(ch)
+	debugLog("📡 [Events] 新的订阅 | Last-Event-ID: %d | 回放: %d | 全量刷新: %t", lastEventId, len(replay), resync)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 2000\n\n")
+
+	if resync {
+		writeEvent(w, Event{Type: EventResync, Data: map[string]any{}})
+	}
+	for _, event := range replay {
+		writeEvent(w, event)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"os"
+	"strings"
+	"time"
 )
 
 // TaskRequest 任务请求结构
@@ -12,40 +15,70 @@ type TaskRequest struct {
 	CustomInput   string `json:"customInput"`
 	Continue      bool   `json:"continue"`
 	SelectedIndex *int   `json:"selectedIndex"` // 可选，从AI选项中选择
+	SessionId     string `json:"sessionId"`     // 可选，只投递给指定的MCP会话
+	Priority      int    `json:"priority"`      // 可选，优先级，数值越大越先被AI领取
+	Pinned        bool   `json:"pinned"`        // 可选，置顶
+	Template      string `json:"template"`      // 可选，AI领取时使用的格式化模板
 }
 
 // 启动HTTP服务器
 func StartTaskServer() {
 	// API路由
-	http.HandleFunc("/", serveHomePage)
+	ui := newUIHandler(appConfig.UIDir)
+	http.Handle("/", ui)
 	http.HandleFunc("/api/tasks", handleTasks)
 	http.HandleFunc("/api/tasks/list", handleListTasks)
-	http.HandleFunc("/api/tasks/status", handleTaskStatus) // 获取任务状态
-	http.HandleFunc("/api/tasks/delete", handleDeleteTask) // 删除任务
-	http.HandleFunc("/api/tasks/clear", handleClearTasks) // 清空所有任务
+	http.HandleFunc("/api/tasks/status", handleTaskStatus)               // 获取任务状态
+	http.HandleFunc("/api/tasks/delete", handleDeleteTask)               // 删除任务
+	http.HandleFunc("/api/tasks/clear", handleClearTasks)                // 清空所有任务
+	http.HandleFunc("POST /api/tasks/reorder", handleReorderTasks)       // 拖动排序
+	http.HandleFunc("POST /api/tasks/import", handleImportTasks)         // 批量导入任务文件
+	http.HandleFunc("GET /api/tasks/export", handleExportTasks)          // 按条件导出任务
+	http.HandleFunc("POST /api/tasks/{id}/priority", handleTaskPriority) // 调整优先级和置顶
+	http.HandleFunc("POST /api/tasks/{id}/template", handleTaskTemplate) // 为排队中的任务指定模板
 	http.HandleFunc("/api/render-tasks", handleRenderTasks)
 	http.HandleFunc("/api/render-tasks/select", handleSelectRenderTask)
 	http.HandleFunc("/api/render-tasks/abandon", handleAbandonRenderTask) // 遗弃AI渲染任务
-	http.HandleFunc("/api/format/get", handleGetFormat)                   // 获取格式化字符串
-	http.HandleFunc("/api/format/set", handleSetFormat)                   // 设置格式化字符串
+	http.HandleFunc("POST /api/render-tasks/{id}/select", handleSelectRenderTaskById)
+	http.HandleFunc("POST /api/render-tasks/{id}/abandon", handleAbandonRenderTaskById)
+	http.HandleFunc("POST /api/render-tasks/{id}/approval", handleApproveRenderTask) // 审批 human_approve 的请求
+	http.HandleFunc("POST /api/approvals/verify", handleVerifyApproval)              // 校验审批结论签名
+	http.HandleFunc("/api/format/get", handleGetFormat)                              // 获取格式化字符串
+	http.HandleFunc("/api/format/set", handleSetFormat)                              // 设置格式化字符串
+	http.HandleFunc("POST /api/format/preview", handlePreviewFormat)                 // 校验并预览格式化模板
+	http.HandleFunc("GET /api/templates", handleListTemplates)                       // 模板库和默认模板
+	http.HandleFunc("POST /api/templates", handleCreateTemplate)                     // 新建模板
+	http.HandleFunc("POST /api/templates/defaults", handleSetDefaultTemplate)        // 设置会话、项目的默认模板
+	http.HandleFunc("GET /api/templates/{name}", handleGetTemplate)
+	http.HandleFunc("PUT /api/templates/{name}", handleUpdateTemplate)
+	http.HandleFunc("DELETE /api/templates/{name}", handleDeleteTemplate)
+	http.HandleFunc("GET /api/i18n", handleI18n)     // 页面文案
+	http.HandleFunc("GET /api/events", handleEvents) // 实时事件推送（SSE）
+	http.HandleFunc("GET /metrics", handleMetrics)   // Prometheus 指标
+
+	fmt.Fprintf(console, "📝 任务管理页面: http://%s\n", displayAddr(appConfig.UIAddr))
+	if appConfig.UIDir != "" {
+		fmt.Fprintf(console, "🛠️  页面开发模式: %s（修改后自动刷新）\n", appConfig.UIDir)
+		go watchUIDir(appConfig.UIDir, 500*time.Millisecond)
+	}
+	if appConfig.AuthToken != "" {
+		fmt.Fprintln(console, "🔒 已开启访问令牌认证")
+	}
 
-	fmt.Println("📝 任务管理页面: http://localhost:8094")
-	go http.ListenAndServe(":8094", nil)
+	auth := newAuthManager(appConfig.AuthToken, appConfig.UIAddr, ui.files)
+	go func() {
+		if err := http.ListenAndServe(appConfig.UIAddr, auth.Wrap(http.DefaultServeMux)); err != nil {
+			fmt.Fprintf(console, "❌ 任务管理页面启动失败: %v\n", err)
+		}
+	}()
 }
 
-// serveHomePage 提供主页HTML
-func serveHomePage(w http.ResponseWriter, r *http.Request) {
-	// 读取HTML文件
-	htmlPath := "templates/index.html"
-	content, err := os.ReadFile(htmlPath)
-	if err != nil {
-		debugLog("❌ [HTTP] 读取HTML文件失败 | %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+// displayAddr 把监听地址转换为可以在浏览器中打开的地址
+func displayAddr(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "localhost" + addr
 	}
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Write(content)
+	return addr
 }
 
 // handleTasks 处理手动任务添加请求
@@ -71,24 +104,87 @@ func handleTasks(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "customInput is required", http.StatusBadRequest)
 		return
 	}
+	if task.Template != "" && !globalTemplates.Has(task.Template) {
+		http.Error(w, errTemplateNotFound.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// 创建响应并添加到队列
 	response := UserChoiceResponse{
 		CustomInput:   task.CustomInput,
 		Continue:      task.Continue,
 		SelectedIndex: -1,
+		SessionId:     task.SessionId,
+		Channel:       channelManual,
+		Priority:      task.Priority,
+		Pinned:        task.Pinned,
+		Template:      task.Template,
 	}
 
-	globalSessionManager.PushResponse(response)
-	debugLog("✅ [HTTP] 手动任务已添加 | 输入: %s | 继续: %t", task.CustomInput, task.Continue)
+	taskId, err := globalSessionManager.PushResponse(response)
+	if err != nil {
+		// 队列已满时任务不会被记录，由调用方稍后重试
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	debugLog("✅ [HTTP] 手动任务已添加 | 输入: %s | 继续: %t | 会话: %s", task.CustomInput, task.Continue, task.SessionId)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"status":  "success",
 		"message": "Task added to queue",
+		"taskId":  taskId,
+	})
+}
+
+// handleReorderTasks 处理 POST /api/tasks/reorder，按给定顺序重新排列任务
+// 置顶和优先级仍然优先于手动排列的顺序，拖动只调整同一优先级内的先后
+func handleReorderTasks(w http.ResponseWriter, r *http.Request) {
+	debugLog("🌐 [HTTP] %s %s | 调整任务顺序", r.Method, r.URL.Path)
+
+	var req struct {
+		TaskIds []string `json:"taskIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.TaskIds) == 0 {
+		http.Error(w, "taskIds is required", http.StatusBadRequest)
+		return
+	}
+	if err := globalSessionManager.Taskmng.Reorder(req.TaskIds); err != nil {
+		debugLog("❌ [HTTP] 调整任务顺序失败 | %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"message": "Tasks reordered",
 	})
 }
 
+// handleTaskPriority 处理 POST /api/tasks/{id}/priority，调整任务的优先级和置顶状态
+func handleTaskPriority(w http.ResponseWriter, r *http.Request) {
+	debugLog("🌐 [HTTP] %s %s | 调整任务优先级", r.Method, r.URL.Path)
+
+	var req struct {
+		Priority *int  `json:"priority"`
+		Pinned   *bool `json:"pinned"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Priority == nil && req.Pinned == nil) {
+		http.Error(w, "priority or pinned is required", http.StatusBadRequest)
+		return
+	}
+	task, ok := globalSessionManager.Taskmng.SetPriority(r.PathValue("id"), req.Priority, req.Pinned)
+	if !ok {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
+
 // handleListTasks 返回当前待处理的任务列表（pending状态）
 func handleListTasks(w http.ResponseWriter, r *http.Request) {
 	debugLog("🌐 [HTTP] %s %s | 获取待处理任务列表", r.Method, r.URL.Path)
@@ -120,74 +216,177 @@ func handleRenderTasks(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(tasks)
 }
 
-// handleSelectRenderTask 处理从AI渲染任务中选择选项
+// renderSelectRequest 对渲染任务的响应请求
+type renderSelectRequest struct {
+	RenderTaskId    string `json:"renderTaskId"`    // 可选，不传时处理第一个渲染任务（旧接口兼容）
+	SelectedIndex   *int   `json:"selectedIndex"`   // 单选（旧接口兼容），selectedIndices 不为空时忽略
+	SelectedIndices []int  `json:"selectedIndices"` // 多选，数组顺序即执行顺序
+	CustomInput     string `json:"customInput"`     // 没有选择选项时作为指令，选择了选项时作为补充说明
+	Note            string `json:"note"`            // 补充说明
+	Continue        bool   `json:"continue"`
+}
+
+// handleSelectRenderTask 处理从AI渲染任务中选择选项（旧接口，渲染任务ID在请求体中）
 func handleSelectRenderTask(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var req struct {
-		SelectedIndex *int   `json:"selectedIndex"`
-		CustomInput    string `json:"customInput"`
-		Continue       bool   `json:"continue"`
+	var req renderSelectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
 
+	selectRenderTask(w, req)
+}
+
+// handleSelectRenderTaskById 处理 POST /api/render-tasks/{id}/select
+func handleSelectRenderTaskById(w http.ResponseWriter, r *http.Request) {
+	debugLog("🌐 [HTTP] %s %s | 响应AI渲染任务", r.Method, r.URL.Path)
+
+	var req renderSelectRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	req.RenderTaskId = r.PathValue("id")
 
-	// 获取第一个渲染任务
-	renderTasks := globalSessionManager.GetRenderTasks()
-	if len(renderTasks) == 0 {
-		http.Error(w, "No render task available", http.StatusNotFound)
+	selectRenderTask(w, req)
+}
+
+// selectRenderTask 响应指定的渲染任务，只唤醒等待该渲染任务的工具调用
+func selectRenderTask(w http.ResponseWriter, req renderSelectRequest) {
+	taskId, targetTask, err := answerRenderTask(req, channelWeb)
+	if err != nil {
+		if errors.Is(err, errRenderTaskGone) {
+			http.Error(w, "No render task available", http.StatusNotFound)
+			return
+		}
+		debugLog("❌ [HTTP] 选项无效 | 渲染任务: %s | %v", req.RenderTaskId, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	targetTask := renderTasks[0]
 
-	// 创建响应
-	response := UserChoiceResponse{
-		Continue:     req.Continue,
-		SelectedIndex: -1,
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":       "success",
+		"message":      "Response sent",
+		"taskId":       taskId,
+		"renderTaskId": targetTask.Id,
+	})
+}
+
+// 渲染任务不存在，或已经被其他渠道响应
+var errRenderTaskGone = errors.New("render task not found or already answered")
+
+// answerRenderTask 以指定渠道响应渲染任务，返回生成的任务ID
+// 页面和 MCP elicitation 可能同时响应同一个渲染任务，先移除渲染任务占位的一方胜出
+func answerRenderTask(req renderSelectRequest, channel string) (string, RenderTask, error) {
+	targetTask, ok := findRenderTask(req.RenderTaskId)
+	if !ok {
+		return "", targetTask, errRenderTaskGone
+	}
+	if targetTask.Kind == renderKindApprove {
+		return "", targetTask, errApprovalTask
 	}
 
-	var responseText string
-	if req.SelectedIndex != nil && *req.SelectedIndex >= 0 && *req.SelectedIndex < len(targetTask.NextOptions) {
-		response.SelectedIndex = *req.SelectedIndex
-		responseText = targetTask.NextOptions[*req.SelectedIndex]
-	} else if req.CustomInput != "" {
-		responseText = req.CustomInput
-	} else {
-		responseText = "结束对话"
+	response, err := buildChoiceResponse(targetTask, req)
+	if err != nil {
+		return "", targetTask, err
+	}
+	response.Channel = channel
+	if targetTask.Kind == renderKindAsk {
+		response.TicketId = targetTask.Id
+	}
+
+	// 先移除渲染任务占位，避免同一个渲染任务被重复响应
+	if !globalSessionManager.RemoveRenderTask(targetTask.Id) {
+		return "", targetTask, errRenderTaskGone
 	}
-	response.CustomInput = responseText
 
-	// 发送到Out通道
-	globalSessionManager.PushResponse(response)
+	// 发送给等待该渲染任务的调用，对渲染任务的回答不受队列容量限制
+	taskId, _ := globalSessionManager.PushResponse(response)
+	debugLog("✅ [Answer] 渲染任务已响应 | 渠道: %s | 渲染任务: %s | TaskID: %s | 选项: %v | 输入: %s", channel, targetTask.Id, taskId, response.SelectedIndices, response.CustomInput)
 
 	// 如果是结束对话，直接标记任务为完成（因为AI不会再给反馈）
 	if !req.Continue {
-		// 获取刚创建的任务（最后一个任务）
-		allTasks := globalSessionManager.Taskmng.GetAllTasks()
-		if len(allTasks) > 0 {
-			lastTask := allTasks[len(allTasks)-1]
-			globalSessionManager.Taskmng.UpdateTask(lastTask.TaskId, "completed", "用户结束对话")
-			debugLog("✅ [HTTP] 结束任务已直接标记为完成 | TaskID: %s", lastTask.TaskId)
+		globalSessionManager.Taskmng.UpdateTask(taskId, "completed", globalI18n.Text(sessionLocale(targetTask.SessionId), "record.stopped"))
+		debugLog("✅ [Answer] 结束任务已直接标记为完成 | TaskID: %s", taskId)
+	}
+	return taskId, targetTask, nil
+}
+
+// buildChoiceResponse 根据用户的选择构建响应，只投递给发起该渲染任务的调用
+// 勾选了多个选项时按用户排列的顺序整理成一条完整指令，补充说明附在最后
+func buildChoiceResponse(task RenderTask, req renderSelectRequest) (UserChoiceResponse, error) {
+	response := UserChoiceResponse{
+		Continue:      req.Continue,
+		SelectedIndex: -1,
+		SessionId:     task.SessionId,
+		RenderTaskId:  task.Id,
+		Note:          strings.TrimSpace(req.Note),
+		Summary:       task.Summary,
+	}
+
+	indices := req.SelectedIndices
+	if len(indices) == 0 && req.SelectedIndex != nil && *req.SelectedIndex >= 0 && *req.SelectedIndex < len(task.NextOptions) {
+		indices = []int{*req.SelectedIndex}
+	}
+
+	seen := make(map[int]bool, len(indices))
+	for _, index := range indices {
+		if index < 0 || index >= len(task.NextOptions) {
+			return response, fmt.Errorf("selectedIndices 中的索引 %d 超出范围（共 %d 个选项）", index, len(task.NextOptions))
 		}
+		if seen[index] {
+			return response, fmt.Errorf("selectedIndices 中的索引 %d 重复", index)
+		}
+		seen[index] = true
+		response.SelectedIndices = append(response.SelectedIndices, index)
+		response.SelectedOptions = append(response.SelectedOptions, task.NextOptions[index].Label)
 	}
 
-	// 移除已处理的渲染任务
-	globalSessionManager.RemoveFirstRenderTask()
+	customInput := strings.TrimSpace(req.CustomInput)
+	switch {
+	case len(response.SelectedOptions) > 0:
+		// 选择了选项时自定义输入不再丢弃，作为补充说明
+		if response.Note == "" {
+			response.Note = customInput
+		}
+		response.SelectedIndex = response.SelectedIndices[0]
+		response.CustomInput = composeChoiceText(sessionLocale(task.SessionId), response.SelectedOptions, response.Note)
+	case customInput != "":
+		response.CustomInput = customInput
+	case response.Note != "":
+		response.CustomInput = response.Note
+	default:
+		response.CustomInput = globalI18n.Prompt(sessionLocale(task.SessionId), "choice_stop", InstructionData{})
+	}
+	return response, nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "success",
-		"message": "Response sent",
-	})
+// composeChoiceText 把选中的选项和补充说明整理成发给AI的指令，文案使用会话的语言
+func composeChoiceText(locale string, options []string, note string) string {
+	var b strings.Builder
+	if len(options) == 1 {
+		b.WriteString(options[0])
+	} else {
+		b.WriteString(globalI18n.Prompt(locale, "choice_sequence", InstructionData{}))
+		for i, option := range options {
+			fmt.Fprintf(&b, "\n%d. %s", i+1, option)
+		}
+	}
+	if note != "" {
+		b.WriteString("\n\n")
+		b.WriteString(globalI18n.Prompt(locale, "choice_note", InstructionData{}))
+		b.WriteString(note)
+	}
+	return b.String()
 }
 
-// handleAbandonRenderTask 遗弃AI渲染任务
+// handleAbandonRenderTask 遗弃AI渲染任务（旧接口，渲染任务ID在可选的请求体中）
 func handleAbandonRenderTask(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -196,27 +395,61 @@ func handleAbandonRenderTask(w http.ResponseWriter, r *http.Request) {
 
 	debugLog("🌐 [HTTP] %s %s | 遗弃AI渲染任务", r.Method, r.URL.Path)
 
-	// 获取第一个渲染任务
-	renderTasks := globalSessionManager.GetRenderTasks()
-	if len(renderTasks) == 0 {
-		debugLog("❌ [HTTP] 没有可遗弃的渲染任务")
-		http.Error(w, "No render task available", http.StatusNotFound)
+	// 请求体可选，不传时遗弃第一个渲染任务
+	var req struct {
+		RenderTaskId string `json:"renderTaskId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		debugLog("❌ [HTTP] 请求体解析失败 | %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	abandonedTask := renderTasks[0]
-	debugLog("🗑️  [HTTP] 遗弃AI渲染任务 | 摘要: %s", abandonedTask.Summary)
+	abandonRenderTask(w, req.RenderTaskId)
+}
+
+// handleAbandonRenderTaskById 处理 POST /api/render-tasks/{id}/abandon
+func handleAbandonRenderTaskById(w http.ResponseWriter, r *http.Request) {
+	debugLog("🌐 [HTTP] %s %s | 遗弃AI渲染任务", r.Method, r.URL.Path)
+	abandonRenderTask(w, r.PathValue("id"))
+}
 
-	// 移除第一个渲染任务
-	globalSessionManager.RemoveFirstRenderTask()
+// abandonRenderTask 从页面上移除渲染任务，等待中的调用继续等待会话或共享队列中的指令
+func abandonRenderTask(w http.ResponseWriter, id string) {
+	abandonedTask, ok := findRenderTask(id)
+	if ok && abandonedTask.Kind == renderKindApprove {
+		// 遗弃后发起审批的调用会一直等待，审批只能批准或拒绝
+		http.Error(w, errApprovalTask.Error(), http.StatusBadRequest)
+		return
+	}
+	if !ok || !globalSessionManager.RemoveRenderTask(abandonedTask.Id) {
+		debugLog("❌ [HTTP] 没有可遗弃的渲染任务 | ID: %s", id)
+		http.Error(w, "No render task available", http.StatusNotFound)
+		return
+	}
+	globalTickets.Abandon(abandonedTask.Id)
+	debugLog("🗑️  [HTTP] 遗弃AI渲染任务 | ID: %s | 摘要: %s", abandonedTask.Id, abandonedTask.Summary)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "success",
-		"message": "Task abandoned",
+		"status":       "success",
+		"message":      "Task abandoned",
+		"renderTaskId": abandonedTask.Id,
 	})
 }
 
+// findRenderTask 按ID查找渲染任务，id为空时返回第一个渲染任务
+func findRenderTask(id string) (RenderTask, bool) {
+	if id != "" {
+		return globalSessionManager.GetRenderTask(id)
+	}
+	renderTasks := globalSessionManager.GetRenderTasks()
+	if len(renderTasks) == 0 {
+		return RenderTask{}, false
+	}
+	return renderTasks[0], true
+}
+
 // handleDeleteTask 删除指定任务
 func handleDeleteTask(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
@@ -243,7 +476,7 @@ func handleDeleteTask(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 删除任务
-	if globalSessionManager.Taskmng.DeleteTask(req.TaskId) {
+	if globalSessionManager.DeleteTask(req.TaskId) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{
 			"status":  "success",
@@ -264,7 +497,7 @@ func handleClearTasks(w http.ResponseWriter, r *http.Request) {
 	debugLog("🌐 [HTTP] %s %s | 清空所有任务", r.Method, r.URL.Path)
 
 	// 清空所有任务
-	count := globalSessionManager.Taskmng.ClearAllTasks()
+	count := globalSessionManager.ClearAllTasks()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -278,24 +511,25 @@ func handleClearTasks(w http.ResponseWriter, r *http.Request) {
 func handleTaskStatus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// 从 TaskManager 获取所有任务状态
-	tasks := globalSessionManager.Taskmng.GetAllTasks()
+	// 从 TaskManager 获取所有任务状态的快照，编码时不与AI领取、完成任务的写入竞争
+	tasks := globalSessionManager.Taskmng.SnapshotTasks()
 	json.NewEncoder(w).Encode(tasks)
 }
 
-// handleGetFormat 获取当前格式化字符串
+// handleGetFormat 获取当前格式化模板和可用的变量
 func handleGetFormat(w http.ResponseWriter, r *http.Request) {
-	debugLog("🌐 [HTTP] %s %s | 获取格式化字符串", r.Method, r.URL.Path)
+	debugLog("🌐 [HTTP] %s %s | 获取格式化模板", r.Method, r.URL.Path)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"format": Format,
+	json.NewEncoder(w).Encode(map[string]any{
+		"format":    globalPrompt.Source(),
+		"variables": promptVariables(requestLocale(r)),
 	})
 }
 
-// handleSetFormat 设置格式化字符串
+// handleSetFormat 校验并设置格式化模板，校验失败时返回 400，原模板保持不变
 func handleSetFormat(w http.ResponseWriter, r *http.Request) {
-	debugLog("🌐 [HTTP] %s %s | 设置格式化字符串", r.Method, r.URL.Path)
+	debugLog("🌐 [HTTP] %s %s | 设置格式化模板", r.Method, r.URL.Path)
 
 	if r.Method != http.MethodPost {
 		debugLog("❌ [HTTP] 方法不允许 | %s", r.Method)
@@ -313,20 +547,42 @@ func handleSetFormat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Format == "" {
-		debugLog("❌ [HTTP] 格式化字符串不能为空")
-		http.Error(w, "Format cannot be empty", http.StatusBadRequest)
+	if err := globalPrompt.Set(req.Format); err != nil {
+		debugLog("❌ [HTTP] 格式化模板无效 | %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// 更新全局格式化字符串
-	Format = req.Format
-	debugLog("✅ [HTTP] 格式化字符串已更新 | 新值: %s", Format)
+	debugLog("✅ [HTTP] 格式化模板已更新 | 新值: %s", req.Format)
+	globalEvents.Publish(EventFormatChanged, map[string]string{"format": req.Format})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":  "success",
 		"message": "Format updated",
-		"format":  Format,
+		"format":  req.Format,
+	})
+}
+
+// handlePreviewFormat 处理 POST /api/format/preview，用示例数据渲染模板，不会修改当前模板
+func handlePreviewFormat(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Format string `json:"format"`
+		Input  string `json:"input"` // 可选，预览时使用的用户输入
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	output, warnings, err := PreviewPrompt(requestLocale(r), req.Format, req.Input)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"output":   output,
+		"warnings": warnings,
 	})
 }
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -11,26 +13,49 @@ import (
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
-var Format string = "%s" // 可导出的格式化字符串，用于格式化用户输入
+// 全局debug开关，启动时由配置 debug 控制输出
+var debugMode bool
 
-// 全局debug开关，通过环境变量 HUMAN_IN_MCP_DEBUG 控制输出
-var debugMode = os.Getenv("HUMAN_IN_MCP_DEBUG") == "true"
+// 等待用户响应超时后的兜底行为
+const (
+	onTimeoutWait = "wait" // 提示AI重新调用工具继续等待
+	onTimeoutStop = "stop" // 提示AI停止工作
+)
+
+var errWaitTimeout = errors.New("等待用户响应超时")
+
+// AI带回的 taskId 无法完成的原因（任务不存在时为 errTaskNotFound），返回给AI时换成对应语言的提示
+var (
+	errTaskCompleted  = errors.New("task already completed")
+	errTaskNotClaimed = errors.New("task has not been claimed")
+)
 
 // 全局日志文件
 var logFile *os.File
 
+// 控制台输出，stdio 传输模式下切换到 stderr，避免污染 stdout 上的 JSON-RPC 协议流
+var console io.Writer = os.Stdout
+
+// MCP 传输方式
+const (
+	transportStdio = "stdio"
+	transportSSE   = "sse"
+	transportHTTP  = "http"
+)
+
 // initLog 初始化日志文件
 func initLog() error {
 	if !debugMode {
 		return nil
 	}
 
-	// 创建日志文件路径
-	logPath := "human_in_mcp_debug.log"
+	// 日志文件路径
+	logPath := appConfig.LogPath
 
 	// 打开日志文件（追加模式，如果不存在则创建）
 	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
@@ -41,7 +66,7 @@ func initLog() error {
 	logFile = file
 
 	// 设置日志输出到文件和标准输出
-	log.SetOutput(io.MultiWriter(os.Stdout, logFile))
+	log.SetOutput(io.MultiWriter(console, logFile))
 	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
 
 	log.Println("🚀 [系统] 日志系统初始化完成 | 日志文件: " + logPath)
@@ -65,68 +90,172 @@ func debugLog(format string, v ...interface{}) {
 
 type TaskStatus struct {
 	TaskId string `json:"taskId"`
-	Status string `json:"status"` // pending, processing, completed
-	Req    string `json:"req"`    // 原始的请求
-	Resp   string `json:"resp"`   // 响应之后携带的summary
+	Alias  string `json:"alias,omitempty"` // 短别名（T-1、T-2…），旧版本记录的任务没有别名
+	Status string `json:"status"`          // pending, processing, completed
+	Req    string `json:"req"`             // 原始的请求
+	Resp   string `json:"resp"`            // 响应之后携带的summary
+
+	Channel   string `json:"channel,omitempty"`   // 用户响应的渠道: web | elicitation | manual | import
+	Priority  int    `json:"priority"`            // 优先级，数值越大越先被AI领取
+	Pinned    bool   `json:"pinned,omitempty"`    // 置顶，置顶的任务先于所有未置顶的任务被领取
+	SessionId string `json:"sessionId,omitempty"` // 指定投递的会话，没有指定时为领取该任务的会话
+
+	Template    string `json:"template,omitempty"`    // 指定的格式化模板，为空时使用会话、项目的默认模板或全局模板
+	Instruction string `json:"instruction,omitempty"` // AI领取时格式化后的完整指令
+
+	// 旧版本持久化的任务没有时间信息
+	CreatedAt   time.Time `json:"createdAt,omitzero"`   // 创建时间
+	UpdatedAt   time.Time `json:"updatedAt,omitzero"`   // 最后一次状态变更的时间
+	CompletedAt time.Time `json:"completedAt,omitzero"` // 完成时间
 }
 
+// 用户响应的渠道
+const (
+	channelWeb         = "web"         // 任务管理页面上响应AI渲染任务
+	channelElicitation = "elicitation" // MCP 客户端通过 elicitation 在自己的界面上响应
+	channelManual      = "manual"      // 任务管理页面上手动添加的任务
+	channelImport      = "import"      // 通过 /api/tasks/import 批量导入的任务
+)
+
 type TaskManager struct {
 	mu    sync.RWMutex
-	tasks []*TaskStatus // 使用slice保持添加顺序
+	tasks []*TaskStatus // 使用slice保持添加顺序，拖动排序后为手动排列的顺序
+	store Store         // 持久化存储，所有变更写穿
 }
 
 func NewTaskManager() *TaskManager {
 	debugLog("📋 [TaskManager] 初始化任务管理器")
 	return &TaskManager{
 		tasks: make([]*TaskStatus, 0),
+		store: memoryStore{},
+	}
+}
+
+// persistTask 把任务写入存储（调用方需持有锁）
+func (tm *TaskManager) persistTask(task *TaskStatus) {
+	if err := tm.store.SaveTask(*task); err != nil {
+		debugLog("❌ [TaskManager] 持久化任务失败 | ID: %s | %v", task.TaskId, err)
 	}
 }
 
-func (tm *TaskManager) AddTask(taskId, req string) {
+// AddTask 添加 pending 状态的任务，状态和时间由任务管理器填写
+func (tm *TaskManager) AddTask(task TaskStatus) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 	// 检查是否已存在（避免重复）
-	for _, task := range tm.tasks {
-		if task.TaskId == taskId {
-			debugLog("⚠️  [TaskManager] 任务已存在，跳过添加 | ID: %s", taskId)
+	for _, existing := range tm.tasks {
+		if existing.TaskId == task.TaskId {
+			debugLog("⚠️  [TaskManager] 任务已存在，跳过添加 | ID: %s", task.TaskId)
 			return
 		}
 	}
 	// 添加新任务到末尾
-	tm.tasks = append(tm.tasks, &TaskStatus{
-		TaskId: taskId,
-		Status: "pending",
-		Req:    req,
-	})
-	debugLog("✅ [TaskManager] 新建任务 | ID: %s | 状态: pending | 请求: %s", taskId, req)
+	task.Status = "pending"
+	task.CreatedAt = time.Now()
+	task.UpdatedAt = task.CreatedAt
+	tm.tasks = append(tm.tasks, &task)
+	tm.persistTask(&task)
+	globalEvents.Publish(EventTaskStatusChanged, task)
+	debugLog("✅ [TaskManager] 新建任务 | ID: %s | 状态: pending | 渠道: %s | 会话: %s | 优先级: %d | 置顶: %t | 请求: %s",
+		task.TaskId, task.Channel, task.SessionId, task.Priority, task.Pinned, task.Req)
 }
 
 func (tm *TaskManager) UpdateTask(taskId, status, resp string) {
+	tm.updateTask(taskId, status, resp, "")
+}
+
+// ClaimTask 任务被AI领取，标记为 processing，记录格式化后的指令；没有指定会话的任务记录领取它的会话
+// 只有 pending 的任务可以被领取：用户选择结束对话时任务已经被标记为 completed，不能被改回 processing
+func (tm *TaskManager) ClaimTask(taskId, sessionId, instruction, resp string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	task, ok := tm.findTask(taskId)
+	if !ok {
+		debugLog("⚠️  [TaskManager] 任务不存在，无法更新 | ID: %s", taskId)
+		return
+	}
+	if task.Status != "pending" {
+		debugLog("⚠️  [TaskManager] 任务不是等待状态，忽略领取 | ID: %s | 状态: %s", taskId, task.Status)
+		return
+	}
+	task.Instruction = instruction
+	tm.setStatus(task, "processing", resp, sessionId)
+}
+
+func (tm *TaskManager) updateTask(taskId, status, resp, sessionId string) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 	for _, task := range tm.tasks {
 		if task.TaskId == taskId {
-			oldStatus := task.Status
-			task.Status = status
-			task.Resp = resp
-			debugLog("🔄 [TaskManager] 更新任务 | ID: %s | %s -> %s | 响应: %s", taskId, oldStatus, status, resp)
+			tm.setStatus(task, status, resp, sessionId)
 			return
 		}
 	}
 	debugLog("⚠️  [TaskManager] 任务不存在，无法更新 | ID: %s", taskId)
 }
 
+// setStatus 更新任务状态并持久化（调用方需持有锁）
+func (tm *TaskManager) setStatus(task *TaskStatus, status, resp, sessionId string) {
+	oldStatus := task.Status
+	task.Status = status
+	task.Resp = resp
+	task.UpdatedAt = time.Now()
+	if status == "completed" {
+		task.CompletedAt = task.UpdatedAt
+	}
+	if task.SessionId == "" {
+		task.SessionId = sessionId
+	}
+	tm.persistTask(task)
+	globalEvents.Publish(EventTaskStatusChanged, *task)
+	debugLog("🔄 [TaskManager] 更新任务 | ID: %s | %s -> %s | 响应: %s", task.TaskId, oldStatus, status, resp)
+}
+
+// GetTask 按任务ID或别名查找任务
 func (tm *TaskManager) GetTask(taskId string) (*TaskStatus, bool) {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
+	return tm.findTask(taskId)
+}
+
+// SnapshotTask 按任务ID或别名查找任务，在持有锁时复制一份返回
+func (tm *TaskManager) SnapshotTask(taskId string) (TaskStatus, bool) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	if task, ok := tm.findTask(taskId); ok {
+		return *task, true
+	}
+	return TaskStatus{}, false
+}
+
+// findTask 按任务ID或别名查找任务（调用方需持有锁）
+func (tm *TaskManager) findTask(taskId string) (*TaskStatus, bool) {
 	for _, task := range tm.tasks {
-		if task.TaskId == taskId {
+		if task.TaskId == taskId || (task.Alias != "" && task.Alias == taskId) {
 			return task, true
 		}
 	}
 	return nil, false
 }
 
+// CompleteTask 把AI带回的任务标记为完成，taskId 可以是任务ID或别名
+// 只有已被AI领取（processing）的任务才能完成：ID 不存在（例如来自已清空的旧任务）、任务已完成或尚未被领取时返回错误
+func (tm *TaskManager) CompleteTask(taskId, resp string) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	task, ok := tm.findTask(taskId)
+	switch {
+	case !ok:
+		return fmt.Errorf("%w: %s", errTaskNotFound, taskId)
+	case task.Status == "completed":
+		return fmt.Errorf("%w: %s", errTaskCompleted, taskId)
+	case task.Status == "pending":
+		return fmt.Errorf("%w: %s", errTaskNotClaimed, taskId)
+	}
+	tm.setStatus(task, "completed", resp, "")
+	return nil
+}
+
 func (tm *TaskManager) GetAllTasks() []*TaskStatus {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
@@ -137,6 +266,127 @@ func (tm *TaskManager) GetAllTasks() []*TaskStatus {
 	return tasks
 }
 
+// SnapshotTasks 在持有锁时复制所有任务，返回的值不再与任务管理器共享，可以在锁外读取和序列化
+func (tm *TaskManager) SnapshotTasks() []TaskStatus {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	tasks := make([]TaskStatus, len(tm.tasks))
+	for i, task := range tm.tasks {
+		tasks[i] = *task
+	}
+	return tasks
+}
+
+// SetPriority 调整任务的优先级和置顶状态，参数为 nil 时保持不变
+func (tm *TaskManager) SetPriority(taskId string, priority *int, pinned *bool) (TaskStatus, bool) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	for _, task := range tm.tasks {
+		if task.TaskId == taskId {
+			if priority != nil {
+				task.Priority = *priority
+			}
+			if pinned != nil {
+				task.Pinned = *pinned
+			}
+			tm.persistTask(task)
+			globalEvents.Publish(EventTaskStatusChanged, *task)
+			debugLog("📌 [TaskManager] 调整优先级 | ID: %s | 优先级: %d | 置顶: %t", taskId, task.Priority, task.Pinned)
+			return *task, true
+		}
+	}
+	return TaskStatus{}, false
+}
+
+// SetTemplate 为还在排队的任务指定格式化模板，name 为空时取消指定
+func (tm *TaskManager) SetTemplate(taskId, name string) (TaskStatus, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	task, ok := tm.findTask(taskId)
+	switch {
+	case !ok:
+		return TaskStatus{}, errTaskNotFound
+	case task.Status != "pending":
+		return TaskStatus{}, errTaskNotPending
+	}
+	task.Template = name
+	tm.persistTask(task)
+	globalEvents.Publish(EventTaskStatusChanged, *task)
+	debugLog("🧩 [TaskManager] 指定任务模板 | ID: %s | 模板: %s", task.TaskId, name)
+	return *task, nil
+}
+
+// taskTemplate 返回任务的别名和指定的格式化模板
+func (tm *TaskManager) taskTemplate(taskId string) (alias, name string) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	if task, ok := tm.findTask(taskId); ok {
+		return task.Alias, task.Template
+	}
+	return "", ""
+}
+
+// Reorder 按 taskIds 的顺序重新排列这些任务，它们依次占用原来所在的位置，其他任务位置不变
+// 有未知或重复的任务ID时不做任何修改
+func (tm *TaskManager) Reorder(taskIds []string) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	known := make(map[string]bool, len(tm.tasks))
+	for _, task := range tm.tasks {
+		known[task.TaskId] = true
+	}
+	moved := make(map[string]bool, len(taskIds))
+	for _, id := range taskIds {
+		if !known[id] {
+			return fmt.Errorf("任务不存在: %s", id)
+		}
+		if moved[id] {
+			return fmt.Errorf("任务ID重复: %s", id)
+		}
+		moved[id] = true
+	}
+
+	reorderTasks(tm.tasks, taskIds)
+	if err := tm.store.ReorderTasks(taskIds); err != nil {
+		debugLog("❌ [TaskManager] 持久化排序失败 | %v", err)
+	}
+	globalEvents.Publish(EventTaskStatusChanged, map[string]any{"reordered": taskIds})
+	debugLog("↕️  [TaskManager] 调整任务顺序 | 数量: %d", len(taskIds))
+	return nil
+}
+
+// reorderTasks 把 taskIds 中的任务按给定顺序依次放回它们原来占用的位置
+// taskIds 必须都在 tasks 中且不重复
+func reorderTasks(tasks []*TaskStatus, taskIds []string) {
+	byId := make(map[string]*TaskStatus, len(taskIds))
+	for _, task := range tasks {
+		byId[task.TaskId] = task
+	}
+	moved := make(map[string]bool, len(taskIds))
+	for _, id := range taskIds {
+		moved[id] = true
+	}
+	next := 0
+	for i, task := range tasks {
+		if moved[task.TaskId] {
+			tasks[i] = byId[taskIds[next]]
+			next++
+		}
+	}
+}
+
+// dispatchRanks 返回所有任务的调度顺序
+func (tm *TaskManager) dispatchRanks() dispatchRanks {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	ranks := make(dispatchRanks, len(tm.tasks))
+	for i, task := range tm.tasks {
+		ranks[task.TaskId] = dispatchRank{pinned: task.Pinned, priority: task.Priority, index: i}
+	}
+	return ranks
+}
+
 // DeleteTask 删除指定任务
 func (tm *TaskManager) DeleteTask(taskId string) bool {
 	tm.mu.Lock()
@@ -146,6 +396,10 @@ func (tm *TaskManager) DeleteTask(taskId string) bool {
 		if task.TaskId == taskId {
 			// 删除该任务
 			tm.tasks = append(tm.tasks[:i], tm.tasks[i+1:]...)
+			if err := tm.store.DeleteTask(taskId); err != nil {
+				debugLog("❌ [TaskManager] 持久化删除失败 | ID: %s | %v", taskId, err)
+			}
+			globalEvents.Publish(EventTaskStatusChanged, map[string]any{"taskId": taskId, "deleted": true})
 			debugLog("🗑️  [TaskManager] 删除任务 | ID: %s", taskId)
 			return true
 		}
@@ -161,23 +415,102 @@ func (tm *TaskManager) ClearAllTasks() int {
 
 	count := len(tm.tasks)
 	tm.tasks = make([]*TaskStatus, 0)
+	if err := tm.store.ClearTasks(); err != nil {
+		debugLog("❌ [TaskManager] 持久化清空失败 | %v", err)
+	}
+	globalEvents.Publish(EventTaskStatusChanged, map[string]any{"cleared": count})
 	debugLog("🗑️  [TaskManager] 清空所有任务 | 已删除: %d 个任务", count)
 	return count
 }
 
 // UserChoiceResponse 用户的选择响应
 type UserChoiceResponse struct {
-	TaskId        string `json:"taskId"`        // 任务ID，创建的任务id
-	SelectedIndex int    `json:"selectedIndex"` // 用户选择的选项索引（-1表示自定义输入）
-	CustomInput   string `json:"customInput"`   // 自定义输入内容
-	Continue      bool   `json:"continue"`      // 是否继续对话
+	TaskId        string `json:"taskId"`             // 任务ID，创建的任务id
+	SelectedIndex int    `json:"selectedIndex"`      // 用户选择的选项索引（-1表示自定义输入），多选时为第一个选项
+	CustomInput   string `json:"customInput"`        // 自定义输入内容，多选时为按顺序整理好的完整指令
+	Continue      bool   `json:"continue"`           // 是否继续对话
+	SessionId     string `json:"sessionId"`          // 目标MCP会话ID，为空表示任意会话都可以领取
+	Priority      int    `json:"priority,omitempty"` // 手动任务的初始优先级
+	Pinned        bool   `json:"pinned,omitempty"`   // 手动任务是否置顶
+	Template      string `json:"template,omitempty"` // 手动任务指定的格式化模板
+	Raw           bool   `json:"raw,omitempty"`      // CustomInput 是原始输入，AI领取时才格式化（旧版本持久化的响应入队时已经格式化）
+	RenderTaskId  string `json:"renderTaskId"`       // 响应的渲染任务ID，优先投递给等待该渲染任务的调用
+
+	SelectedIndices []int           `json:"selectedIndices,omitempty"` // 用户勾选的选项索引，按用户排列的执行顺序
+	SelectedOptions []string        `json:"selectedOptions,omitempty"` // 与 SelectedIndices 一一对应的选项文本
+	Note            string          `json:"note,omitempty"`            // 用户附加的补充说明
+	Summary         string          `json:"summary,omitempty"`         // 用户回答的渲染任务中AI给出的总结，供格式化模板引用
+	AnsweredAt      time.Time       `json:"answeredAt,omitzero"`       // 用户响应时间
+	Channel         string          `json:"channel,omitempty"`         // 用户响应的渠道
+	TicketId        string          `json:"ticketId,omitempty"`        // 回答的异步提问ID，这类响应交给 human_check 领取，不进入响应队列
+	Approval        *ApprovalResult `json:"approval,omitempty"`        // 带签名的审批结论，这类响应只投递给等待该审批的调用
+}
+
+// human_interaction 工具结果中的 decision 取值
+const (
+	decisionContinue = "continue" // 用户给出了新的任务
+	decisionStop     = "stop"     // 用户结束对话，或超时后要求停止
+	decisionTimeout  = "timeout"  // 等待超时，需要重新调用继续等待
+)
+
+// HumanInteractionResult human_interaction 工具的结构化返回结果（structuredContent），与工具声明的 outputSchema 一致
+type HumanInteractionResult struct {
+	Decision        string    `json:"decision" jsonschema:"enum=continue,enum=stop,enum=timeout" jsonschema_description:"continue 执行 instruction 后再次调用本工具；stop 停止工作；timeout 用相同参数再次调用本工具继续等待"`
+	Continue        bool      `json:"continue" jsonschema_description:"是否需要继续调用本工具"`
+	TaskId          string    `json:"taskId" jsonschema_description:"本次任务ID，完成后再次调用本工具时通过 taskId 参数带回，超时时为空"`
+	Instruction     string    `json:"instruction" jsonschema_description:"用户给出的完整指令（已按格式化字符串处理）"`
+	SelectedIndices []int     `json:"selectedIndices" jsonschema_description:"用户选择的 nextOptions 索引，按执行顺序排列，没有选择时为空数组"`
+	SelectedOptions []string  `json:"selectedOptions" jsonschema_description:"与 selectedIndices 一一对应的选项文本"`
+	Note            string    `json:"note" jsonschema_description:"用户附加的补充说明"`
+	RenderTaskId    string    `json:"renderTaskId" jsonschema_description:"本次调用在页面上创建的渲染任务ID"`
+	RequestedAt     time.Time `json:"requestedAt" jsonschema_description:"工具调用开始等待的时间"`
+	AnsweredAt      time.Time `json:"answeredAt,omitzero" jsonschema_description:"用户响应的时间，超时时不返回"`
+	WaitedMs        int64     `json:"waitedMs" jsonschema_description:"等待用户响应的毫秒数"`
+	Channel         string    `json:"channel,omitempty" jsonschema:"enum=web,enum=elicitation,enum=manual,enum=import" jsonschema_description:"用户响应的渠道：web 任务管理页面，elicitation 客户端界面，manual 页面上手动添加的任务，import 批量导入的任务；超时时不返回"`
+}
+
+// newInteractionResult 根据用户响应构建结构化结果
+func newInteractionResult(task RenderTask, response UserChoiceResponse) HumanInteractionResult {
+	result := HumanInteractionResult{
+		Decision:        decisionStop,
+		Continue:        response.Continue,
+		TaskId:          response.TaskId,
+		Instruction:     response.CustomInput,
+		SelectedIndices: response.SelectedIndices,
+		SelectedOptions: response.SelectedOptions,
+		Note:            response.Note,
+		RenderTaskId:    task.Id,
+		RequestedAt:     task.CreatedAt,
+		AnsweredAt:      response.AnsweredAt,
+		WaitedMs:        time.Since(task.CreatedAt).Milliseconds(),
+		Channel:         response.Channel,
+	}
+	if response.Continue {
+		result.Decision = decisionContinue
+	}
+	// 旧的单选响应和手动任务没有 SelectedIndices
+	if len(result.SelectedIndices) == 0 && response.SelectedIndex >= 0 && response.SelectedIndex < len(task.NextOptions) && response.RenderTaskId == task.Id {
+		result.SelectedIndices = []int{response.SelectedIndex}
+		result.SelectedOptions = []string{task.NextOptions[response.SelectedIndex].Label}
+	}
+	if result.SelectedIndices == nil {
+		result.SelectedIndices = []int{}
+		result.SelectedOptions = []string{}
+	}
+	return result
 }
 
 // RenderTask AI渲染任务，包含需要显示的信息
 type RenderTask struct {
-	NextOptions  []string `json:"nextOptions"`
-	Summary      string   `json:"summary"`
-	Difficulties string   `json:"difficulties"`
+	Id           string           `json:"id"`
+	NextOptions  []NextOption     `json:"nextOptions"`
+	Summary      string           `json:"summary"`
+	Difficulties string           `json:"difficulties"`
+	SessionId    string           `json:"sessionId"` // 发起请求的MCP会话ID
+	CreatedAt    time.Time        `json:"createdAt"`
+	Kind         string           `json:"kind,omitempty"`     // 渲染任务类型，human_ask 创建的异步提问为 ask
+	ExpiresAt    time.Time        `json:"expiresAt,omitzero"` // 异步提问的过期时间
+	Approval     *ApprovalRequest `json:"approval,omitempty"` // 审批卡片的内容，只有 human_approve 创建的渲染任务有
 }
 
 type RenderTaskStatusful struct {
@@ -188,24 +521,83 @@ type RenderTaskStatusful struct {
 
 // SessionManager 全局单例会话管理器
 type SessionManager struct {
-	Out         chan UserChoiceResponse // 用户响应通道
-	Render      chan RenderTask         // AI渲染任务通道（用于web端显示）
-	mu          sync.RWMutex            // 保护responses切片
-	responses   []UserChoiceResponse    // 缓存已接收的响应
-	renderTasks []RenderTask            // 缓存AI渲染任务
+	Out         *responseQueue                     // 不指定会话的共享队列，按任务的调度顺序领取
+	mu          sync.RWMutex                       // 保护responses切片
+	responses   []UserChoiceResponse               // 缓存已接收的响应
+	renderTasks []RenderTask                       // 缓存AI渲染任务
+	sessionOut  map[string]*responseQueue          // 按MCP会话划分的响应队列
+	waiters     map[string]chan UserChoiceResponse // 按渲染任务ID划分的等待中的工具调用
+	pushMu      sync.Mutex                         // 串行化新指令的容量检查和入队，保证队列不超过容量
+	store       Store                              // 持久化存储，所有变更写穿
 
 	//=====  -- 所有开放的对象都等于SessionManager的相关调用
 	Taskmng *TaskManager // 任务管理器
 
 }
 
-// 全局单例
-var globalSessionManager = &SessionManager{
-	Out:         make(chan UserChoiceResponse, 200),
-	Render:      make(chan RenderTask, 200),
-	responses:   make([]UserChoiceResponse, 0, 200),
-	renderTasks: make([]RenderTask, 0, 200),
-	Taskmng:     NewTaskManager(),
+// 全局单例，启动时按配置的队列容量重新创建
+var globalSessionManager = NewSessionManager(200)
+
+// NewSessionManager 创建会话管理器，capacity 为每个响应队列的容量
+func NewSessionManager(capacity int) *SessionManager {
+	taskmng := NewTaskManager()
+	return &SessionManager{
+		Out:         newResponseQueue(capacity, taskmng),
+		responses:   make([]UserChoiceResponse, 0, capacity),
+		renderTasks: make([]RenderTask, 0, capacity),
+		sessionOut:  make(map[string]*responseQueue),
+		waiters:     make(map[string]chan UserChoiceResponse),
+		store:       memoryStore{},
+		Taskmng:     taskmng,
+	}
+}
+
+// Restore 从存储中恢复状态，并把仍处于pending的响应重新放回Out通道
+// 必须在启动HTTP服务和MCP服务之前调用
+func (sm *SessionManager) Restore(store Store) error {
+	snapshot, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	sm.mu.Lock()
+	sm.store = store
+	sm.responses = append(sm.responses[:0], snapshot.Responses...)
+	// 审批卡片的调用方已经随进程退出，重启后无法再把结论交给它
+	sm.renderTasks = sm.renderTasks[:0]
+	for _, task := range snapshot.RenderTasks {
+		if task.Kind != renderKindApprove {
+			sm.renderTasks = append(sm.renderTasks, task)
+		}
+	}
+	if len(sm.renderTasks) != len(snapshot.RenderTasks) {
+		sm.persistRenderTasks()
+	}
+	sm.mu.Unlock()
+
+	sm.Taskmng.mu.Lock()
+	sm.Taskmng.store = store
+	sm.Taskmng.tasks = append(sm.Taskmng.tasks[:0], snapshot.Tasks...)
+	sm.Taskmng.mu.Unlock()
+
+	// 任务ID本身跨重启唯一，别名从用过的最大编号之后继续，已删除或清空的任务的别名也不复用
+	insIdGen.Reseed(snapshot.AliasSeq)
+
+	// 按原顺序把未被消费的指令重新入队
+	requeued := 0
+	for _, resp := range snapshot.Responses {
+		task, ok := sm.Taskmng.GetTask(resp.TaskId)
+		if !ok || task.Status != "pending" || resp.TicketId != "" {
+			continue
+		}
+		if sm.deliver(resp) {
+			requeued++
+		}
+	}
+	globalTemplates.Restore(store, snapshot.Templates)
+	globalTickets.Restore(store, snapshot.RenderTasks, snapshot.Responses, snapshot.Tickets)
+	debugLog("♻️  [SessionManager] 状态恢复完成 | 重新入队: %d", requeued)
+	return nil
 }
 
 // AddResponse 添加响应到队列
@@ -213,6 +605,10 @@ func (sm *SessionManager) AddResponse(resp UserChoiceResponse) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	sm.responses = append(sm.responses, resp)
+	if err := sm.store.AppendResponse(resp); err != nil {
+		debugLog("❌ [SessionManager] 持久化响应失败 | TaskID: %s | %v", resp.TaskId, err)
+	}
+	globalEvents.Publish(EventResponseAdded, resp)
 	debugLog("📥 [SessionManager] 添加响应到队列 | TaskID: %s | 输入: %s", resp.TaskId, resp.CustomInput)
 }
 
@@ -223,85 +619,477 @@ func (sm *SessionManager) GetResponses() []UserChoiceResponse {
 	return sm.responses
 }
 
-// AddRenderTask 添加AI渲染任务
+// AddRenderTask 添加AI渲染任务，并登记等待该渲染任务响应的调用
 func (sm *SessionManager) AddRenderTask(task RenderTask) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	sm.renderTasks = append(sm.renderTasks, task)
+	// 异步提问没有等待中的调用，回答由 TicketManager 保存
+	if task.Kind != renderKindAsk {
+		sm.waiters[task.Id] = make(chan UserChoiceResponse, 1)
+	}
+	sm.persistRenderTasks()
+	globalEvents.Publish(EventRenderTaskCreated, task)
 	debugLog("📤 [SessionManager] 添加AI渲染任务 | 摘要: %s | 困难: %s", task.Summary, task.Difficulties)
 }
 
+// persistRenderTasks 把渲染任务列表写入存储（调用方需持有锁）
+func (sm *SessionManager) persistRenderTasks() {
+	if err := sm.store.SaveRenderTasks(sm.renderTasks); err != nil {
+		debugLog("❌ [SessionManager] 持久化渲染任务失败 | %v", err)
+	}
+}
+
 // GetRenderTasks 获取所有AI渲染任务
 func (sm *SessionManager) GetRenderTasks() []RenderTask {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
-	return sm.renderTasks
+	tasks := make([]RenderTask, len(sm.renderTasks))
+	copy(tasks, sm.renderTasks)
+	return tasks
 }
 
-// RemoveFirstRenderTask 移除第一个渲染任务（已处理）
-func (sm *SessionManager) RemoveFirstRenderTask() {
+// GetRenderTask 按ID获取渲染任务
+func (sm *SessionManager) GetRenderTask(id string) (RenderTask, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	for _, task := range sm.renderTasks {
+		if task.Id == id {
+			return task, true
+		}
+	}
+	return RenderTask{}, false
+}
+
+// RemoveRenderTask 按ID移除渲染任务（已处理或调用方已放弃等待）
+func (sm *SessionManager) RemoveRenderTask(id string) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	for i, task := range sm.renderTasks {
+		if task.Id == id {
+			sm.renderTasks = append(sm.renderTasks[:i], sm.renderTasks[i+1:]...)
+			sm.persistRenderTasks()
+			globalEvents.Publish(EventRenderTaskRemoved, map[string]string{"id": id})
+			debugLog("🗑️  [SessionManager] 移除渲染任务 | ID: %s | 摘要: %s", id, task.Summary)
+			return true
+		}
+	}
+	return false
+}
+
+// OpenSession 为MCP会话创建专属响应队列，必须在该会话的渲染任务展示之前调用
+func (sm *SessionManager) OpenSession(sessionId string) *responseQueue {
+	if sessionId == "" {
+		return nil
+	}
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
-	if len(sm.renderTasks) > 0 {
-		removed := sm.renderTasks[0]
-		sm.renderTasks = sm.renderTasks[1:]
-		debugLog("🗑️  [SessionManager] 移除已处理的渲染任务 | 摘要: %s", removed.Summary)
+	q, ok := sm.sessionOut[sessionId]
+	if !ok {
+		q = newResponseQueue(sm.Out.capacity, sm.Taskmng)
+		sm.sessionOut[sessionId] = q
+		debugLog("🔗 [SessionManager] 创建会话队列 | 会话: %s", sessionId)
+	}
+	return q
+}
+
+// CloseSession 关闭会话队列，队列中尚未被领取的响应转入共享队列，避免指令丢失
+func (sm *SessionManager) CloseSession(sessionId string) {
+	sm.mu.Lock()
+	q, ok := sm.sessionOut[sessionId]
+	delete(sm.sessionOut, sessionId)
+	sm.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	for _, resp := range q.Drain() {
+		resp.SessionId = ""
+		sm.deliver(resp)
+	}
+	debugLog("🔗 [SessionManager] 关闭会话队列 | 会话: %s", sessionId)
+}
+
+// deliver 按 渲染任务的等待调用 -> 目标会话队列 -> 共享队列 的顺序投递响应
+// 异步提问的回答交给 TicketManager，等待 human_check 领取
+func (sm *SessionManager) deliver(resp UserChoiceResponse) bool {
+	if resp.TicketId != "" {
+		globalTickets.answer(resp)
+		return true
+	}
+	// 审批结论只对发起审批的调用有意义，调用已经结束时丢弃，不能被其他调用当作指令领取
+	if resp.Approval != nil {
+		sm.mu.RLock()
+		waiter, ok := sm.waiters[resp.RenderTaskId]
+		sm.mu.RUnlock()
+		if !ok || resp.RenderTaskId == "" {
+			debugLog("⚠️  [SessionManager] 审批调用已结束，丢弃审批结论 | TaskID: %s", resp.TaskId)
+			globalMetrics.Drop(dropApprovalGone, 1)
+			return false
+		}
+		select {
+		case waiter <- resp:
+			return true
+		default:
+			globalMetrics.Drop(dropApprovalGone, 1)
+			return false
+		}
+	}
+
+	out := sm.Out
+	sm.mu.RLock()
+	waiter, hasWaiter := sm.waiters[resp.RenderTaskId]
+	if q, ok := sm.sessionOut[resp.SessionId]; ok && resp.SessionId != "" {
+		out = q
+	}
+	sm.mu.RUnlock()
+
+	if hasWaiter && resp.RenderTaskId != "" {
+		select {
+		case waiter <- resp:
+			debugLog("📨 [SessionManager] 响应已投递给等待的调用 | TaskID: %s | 渲染任务: %s", resp.TaskId, resp.RenderTaskId)
+			return true
+		default:
+		}
+	}
+	out.Push(resp)
+	debugLog("📨 [SessionManager] 响应已投递 | TaskID: %s | 会话: %s | 继续: %t", resp.TaskId, resp.SessionId, resp.Continue)
+	return true
+}
+
+// queueFor 返回新指令将要进入的队列：目标会话的队列，没有时为共享队列
+func (sm *SessionManager) queueFor(resp UserChoiceResponse) *responseQueue {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	if q, ok := sm.sessionOut[resp.SessionId]; ok && resp.SessionId != "" {
+		return q
+	}
+	return sm.Out
+}
+
+// DeleteTask 删除任务，仍在队列中等待领取的同时移出队列
+func (sm *SessionManager) DeleteTask(taskId string) bool {
+	sm.pushMu.Lock()
+	defer sm.pushMu.Unlock()
+	for _, q := range sm.queues() {
+		if q.Remove(taskId) {
+			debugLog("🗑️  [SessionManager] 已从队列中移出 | TaskID: %s", taskId)
+		}
+	}
+	return sm.Taskmng.DeleteTask(taskId)
+}
+
+// ClearAllTasks 清空所有任务和所有队列中等待领取的响应
+func (sm *SessionManager) ClearAllTasks() int {
+	sm.pushMu.Lock()
+	defer sm.pushMu.Unlock()
+	for _, q := range sm.queues() {
+		q.Drain()
+	}
+	return sm.Taskmng.ClearAllTasks()
+}
+
+// queues 返回共享队列和所有会话队列
+func (sm *SessionManager) queues() []*responseQueue {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	queues := []*responseQueue{sm.Out}
+	for _, q := range sm.sessionOut {
+		queues = append(queues, q)
+	}
+	return queues
+}
+
+// releaseWaiter 注销渲染任务的等待调用，已到达但未被领取的响应转投给会话队列
+func (sm *SessionManager) releaseWaiter(renderTaskId string) {
+	sm.mu.Lock()
+	ch, ok := sm.waiters[renderTaskId]
+	delete(sm.waiters, renderTaskId)
+	sm.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	select {
+	case resp := <-ch:
+		resp.RenderTaskId = ""
+		sm.deliver(resp)
+	default:
+	}
+}
+
+// WaitResponse 阻塞等待用户响应，直到收到响应、ctx被取消或超时
+// 依次接收：针对该渲染任务的响应、发给该会话的响应、共享队列中的响应，队列中按任务的调度顺序领取
+// timeout <= 0 表示不设超时；调用方断开时已取出的响应会被放回队列，避免被失效的调用消费
+func (sm *SessionManager) WaitResponse(ctx context.Context, task RenderTask, timeout time.Duration) (UserChoiceResponse, error) {
+	sessionOut := sm.OpenSession(task.SessionId)
+	sm.mu.RLock()
+	waiter := sm.waiters[task.Id]
+	sm.mu.RUnlock()
+	defer sm.releaseWaiter(task.Id)
+
+	waitCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var resp UserChoiceResponse
+	for received := false; !received; {
+		select {
+		case resp = <-waiter:
+			received = true
+			continue
+		default:
+		}
+		if resp, received = sessionOut.Pop(); received {
+			continue
+		}
+		if resp, received = sm.Out.Pop(); received {
+			continue
+		}
+
+		// 队列为空，等待新的响应入队后重新按调度顺序领取
+		select {
+		case resp = <-waiter:
+			received = true
+		case <-sessionOut.Ready():
+		case <-sm.Out.Ready():
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return UserChoiceResponse{}, ctx.Err()
+			}
+			return UserChoiceResponse{}, errWaitTimeout
+		}
+	}
+
+	if ctx.Err() != nil {
+		resp.RenderTaskId = ""
+		sm.deliver(resp)
+		return UserChoiceResponse{}, ctx.Err()
+	}
+	if sm.Out.Len() == 0 && sessionOut.Len() == 0 {
+		globalEvents.Publish(EventQueueDrained, map[string]string{"sessionId": task.SessionId, "taskId": resp.TaskId})
+	}
+	return resp, nil
+}
+
+// WaitRenderTask 只等待针对指定渲染任务的响应，不领取会话队列和共享队列中的指令
+// timeout <= 0 表示不设超时；超时时先移除渲染任务，移除失败说明用户已经在页面上作答，改为返回这个回答
+func (sm *SessionManager) WaitRenderTask(ctx context.Context, renderTaskId string, timeout time.Duration) (UserChoiceResponse, error) {
+	sm.mu.RLock()
+	waiter := sm.waiters[renderTaskId]
+	sm.mu.RUnlock()
+	defer sm.releaseWaiter(renderTaskId)
+
+	waitCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	select {
+	case resp := <-waiter:
+		return resp, nil
+	case <-waitCtx.Done():
+		if ctx.Err() != nil {
+			return UserChoiceResponse{}, ctx.Err()
+		}
+	}
+
+	// 页面作答时先移除渲染任务再投递回答，等待者要保留到这里，否则回答会因为调用已结束被丢弃
+	if sm.RemoveRenderTask(renderTaskId) {
+		return UserChoiceResponse{}, errWaitTimeout
+	}
+	debugLog("⏱️  [SessionManager] 超时的同时用户已作答，改为等待该回答 | 渲染任务: %s", renderTaskId)
+	select {
+	case resp := <-waiter:
+		return resp, nil
+	case <-ctx.Done():
+		return UserChoiceResponse{}, ctx.Err()
+	}
+}
+
+// sessionIdFromContext 获取当前MCP会话ID，没有会话时返回空字符串
+func sessionIdFromContext(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// activeCalls 按MCP会话记录正在等待的调用
+// SSE传输下工具调用的ctx不会随客户端断开而取消，需要在会话注销时主动取消
+var activeCalls = &callTracker{calls: make(map[string]map[int64]context.CancelFunc)}
+
+type callTracker struct {
+	mu    sync.Mutex
+	next  int64
+	calls map[string]map[int64]context.CancelFunc
+}
+
+// track 返回一个会在会话注销时被取消的ctx，调用结束后必须调用返回的release
+func (ct *callTracker) track(ctx context.Context) (context.Context, func()) {
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil {
+		return ctx, func() {}
+	}
+	sessionID := session.SessionID()
+	ctx, cancel := context.WithCancel(ctx)
+
+	ct.mu.Lock()
+	ct.next++
+	callID := ct.next
+	if ct.calls[sessionID] == nil {
+		ct.calls[sessionID] = make(map[int64]context.CancelFunc)
+	}
+	ct.calls[sessionID][callID] = cancel
+	ct.mu.Unlock()
+
+	return ctx, func() {
+		ct.mu.Lock()
+		delete(ct.calls[sessionID], callID)
+		if len(ct.calls[sessionID]) == 0 {
+			delete(ct.calls, sessionID)
+		}
+		ct.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancelSession 取消指定会话上所有正在等待的调用
+func (ct *callTracker) cancelSession(sessionID string) {
+	ct.mu.Lock()
+	calls := ct.calls[sessionID]
+	delete(ct.calls, sessionID)
+	ct.mu.Unlock()
+
+	for _, cancel := range calls {
+		cancel()
+	}
+	if len(calls) > 0 {
+		debugLog("🔌 [MCP] 会话已断开，取消等待中的调用 | 会话: %s | 数量: %d", sessionID, len(calls))
 	}
 }
 
 // 唯一的生产位置 只有这个push 才能保证所有关系的同步性
 // 通过队列来维护存储 chan自己不支持队列方式的查询和存储
-// PushResponse 发送响应到Out通道
-func (sm *SessionManager) PushResponse(resp UserChoiceResponse) {
-	resp.CustomInput = fmt.Sprintf(Format, resp.CustomInput) // 格式化输入内容
-	resp.TaskId = insIdGen()                                 // 生成唯一任务ID
+// PushResponse 发送响应到目标会话队列（resp.SessionId 为空时发送到共享队列），返回生成的任务ID
+// 新指令（不是对渲染任务的回答）在目标队列已满时返回 errQueueFull，此时不会记录任务和响应
+func (sm *SessionManager) PushResponse(resp UserChoiceResponse) (string, error) {
+	sm.pushMu.Lock()
+	defer sm.pushMu.Unlock()
+	if resp.RenderTaskId == "" {
+		if err := sm.queueFor(resp).Admit(1); err != nil {
+			debugLog("⚠️  [SessionManager] 响应队列已满，拒绝新指令 | 会话: %s | 输入: %s", resp.SessionId, resp.CustomInput)
+			globalMetrics.Drop(dropQueueFull, 1)
+			return "", err
+		}
+	}
+	return sm.push(resp), nil
+}
+
+// PushResponses 批量发送新指令，要么全部入队，要么在任一目标队列放不下时全部拒绝
+func (sm *SessionManager) PushResponses(resps []UserChoiceResponse) ([]string, error) {
+	sm.pushMu.Lock()
+	defer sm.pushMu.Unlock()
+
+	counts := make(map[*responseQueue]int)
+	for _, resp := range resps {
+		counts[sm.queueFor(resp)]++
+	}
+	for q, n := range counts {
+		if err := q.Admit(n); err != nil {
+			debugLog("⚠️  [SessionManager] 响应队列容量不足，拒绝批量指令 | 数量: %d", n)
+			globalMetrics.Drop(dropQueueFull, len(resps))
+			return nil, err
+		}
+	}
+
+	ids := make([]string, 0, len(resps))
+	for _, resp := range resps {
+		ids = append(ids, sm.push(resp))
+	}
+	return ids, nil
+}
+
+// push 记录响应和任务并投递，返回生成的任务ID（调用方需持有 pushMu）
+func (sm *SessionManager) push(resp UserChoiceResponse) string {
+	id, alias := insIdGen.Next() // 生成唯一任务ID
+	resp.TaskId = id
+	resp.Raw = true // 领取时才知道是哪个会话，格式化放到 formatResponse
+	resp.AnsweredAt = time.Now()
 	sm.AddResponse(resp)
 
-	sm.Taskmng.AddTask(resp.TaskId, resp.CustomInput) // 将任务添加到任务管理器
+	sm.Taskmng.AddTask(TaskStatus{ // 将任务添加到任务管理器
+		TaskId:    resp.TaskId,
+		Alias:     alias,
+		Req:       resp.CustomInput,
+		Channel:   resp.Channel,
+		Priority:  resp.Priority,
+		Pinned:    resp.Pinned,
+		SessionId: resp.SessionId,
+		Template:  resp.Template,
+	})
 
-	select {
-	case sm.Out <- resp:
-		debugLog("📨 [SessionManager] 响应已发送到Out通道 | TaskID: %s | 继续: %t", resp.TaskId, resp.Continue)
-	default:
-		debugLog("⚠️  [SessionManager] Out通道已满，响应未发送 | TaskID: %s", resp.TaskId)
+	sm.deliver(resp)
+	return resp.TaskId
+}
+
+// formatResponse 用领取指令的会话选中的模板格式化用户输入，已格式化的响应原样返回
+func (sm *SessionManager) formatResponse(resp UserChoiceResponse, sessionId string) UserChoiceResponse {
+	if !resp.Raw {
+		return resp
+	}
+	alias, name := sm.Taskmng.taskTemplate(resp.TaskId)
+	data := newPromptData(resp, alias)
+	if sessionId != "" {
+		data.Session = sessionId
 	}
+	resp.CustomInput = globalTemplates.Render(name, sessionId, data)
+	resp.Raw = false
+	return resp
 }
 
-// HumanInTool 定义 MCP 工具
-func HumanInTool() mcp.Tool {
+// HumanInTool 定义 MCP 工具，说明文案使用指定语言
+func HumanInTool(locale string) mcp.Tool {
+	desc := func(key string) string { return globalI18n.Tool(locale, "human_interaction."+key) }
 	return mcp.NewTool(
 		"human_interaction",
-		mcp.WithDescription(`【重要：人机交互循环工具】
-用途：AI完成每个任务后，必须调用此工具向用户展示结果并获取下一步指示。
-工作流程（无限循环）：
-1. AI完成用户指派的任务
-2. AI调用此工具展示任务总结
-3. 用户查看结果并选择下一步
-4. AI收到用户的新任务指示
-5. 重复步骤1...
-调用时机：
-• 每次完成任务后
-• 需要用户决策时
-• 需要展示中间结果时
-• 开始的工作初始化的时候 直接调用这个工具进行询问,可以提供一些元信息的可选项,比如输出当前目录,测试网络连通性等基础功能
-
-注意事项：
-• 这是一个持续循环，直到用户明确选择结束
-• 收到返回结果后，务必按照"【重要指令】"执行`),
-		mcp.WithString("summary", mcp.Required(), mcp.Description("完成任务的简单总结,如果处于起步或初始化状态,直接传递当前工作目录地址即可")),
-		mcp.WithString("taskId", mcp.Description("插件内部提供的唯一任务Id,必须通过该系统内部进行指定,对于完成的每个任务都会生成一个唯一的任务Id , 如果没有对话历史或处于起步或初始化状态,传值不做要求")),
-
-		mcp.WithString("difficulties", mcp.Required(), mcp.Description("遇到的困难、需要的帮助或其他重要信息")),
-		mcp.WithString("nextOptions", mcp.Required(),
-			mcp.Description("接下来的任务可选项，JSON数组字符串格式，例如: [\"继续优化代码\", \"添加测试\", \"提交代码\", \"结束\"]")),
+		mcp.WithDescription(globalI18n.Tool(locale, "human_interaction")),
+		mcp.WithString("summary", mcp.Required(), mcp.Description(desc("summary"))),
+		mcp.WithString("taskId", mcp.Description(desc("taskId"))),
+
+		mcp.WithString("difficulties", mcp.Required(), mcp.Description(desc("difficulties"))),
+		mcp.WithArray("nextOptions", mcp.Required(), mcp.Items(nextOptionsSchema(locale)),
+			mcp.Description(desc("nextOptions"))),
+		mcp.WithNumber("timeoutSeconds", mcp.Description(desc("timeoutSeconds"))),
+		mcp.WithString("onTimeout", mcp.Enum(onTimeoutWait, onTimeoutStop),
+			mcp.Description(desc("onTimeout"))),
+		mcp.WithOutputSchema[HumanInteractionResult](),
 	)
 }
 
-func process(sm *SessionManager, id, summary string) {
-	if id != "" {
-		debugLog("🎯 [MCP] 处理任务完成 | TaskID: %s | 摘要: %s", id, summary)
-		sm.Taskmng.UpdateTask(id, "completed", summary)
+// process 完成AI带回的任务，taskId 无效时返回的错误会作为工具错误返回给AI
+func process(sm *SessionManager, locale, id, summary string) error {
+	if id == "" {
+		return nil
 	}
+	debugLog("🎯 [MCP] 处理任务完成 | TaskID: %s | 摘要: %s", id, summary)
+	if err := sm.Taskmng.CompleteTask(id, summary); err != nil {
+		debugLog("⚠️  [MCP] 拒绝完成任务 | TaskID: %s | %v", id, err)
+		name := "complete_not_found"
+		switch {
+		case errors.Is(err, errTaskCompleted):
+			name = "complete_completed"
+		case errors.Is(err, errTaskNotClaimed):
+			name = "complete_not_claimed"
+		}
+		return errors.New(globalI18n.Prompt(locale, name, InstructionData{TaskId: id}))
+	}
+	return nil
 }
 
 // humanInteractionHandler 处理人机交互请求
@@ -309,100 +1097,204 @@ func humanInteractionHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp
 	startTime := time.Now()
 	debugLog("🤖 [MCP] ========== 人机交互请求开始 ==========")
 
+	ctx, release := activeCalls.track(ctx)
+	defer release()
+	sessionId := sessionIdFromContext(ctx)
+	locale := localeFromContext(ctx)
+
 	// 解析参数
 	summary, _ := req.RequireString("summary")
 	difficulties, _ := req.RequireString("difficulties")
-	nextOptionsStr, _ := req.RequireString("nextOptions")
 	id, _ := req.RequireString("taskId")
+	onTimeout := req.GetString("onTimeout", appConfig.OnTimeout)
+	timeout := appConfig.WaitTimeout
+	if secs := req.GetFloat("timeoutSeconds", 0); secs > 0 {
+		timeout = time.Duration(secs * float64(time.Second))
+	}
 
-	debugLog("📝 [MCP] 请求参数 | TaskID: %s | 摘要: %s | 困难: %s", id, summary, difficulties)
+	debugLog("📝 [MCP] 请求参数 | 会话: %s | TaskID: %s | 摘要: %s | 困难: %s", sessionId, id, summary, difficulties)
 
-	// 完成相关的任务
-	process(globalSessionManager, id, summary)
+	nextOptions, err := parseNextOptions(req.GetArguments()["nextOptions"])
+	if err != nil {
+		debugLog("❌ [MCP] 下一步选项格式错误 | %v", err)
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	debugLog("📋 [MCP] 下一步选项: %v", optionLabels(nextOptions))
 
-	var nextOptions []string
-	if err := json.Unmarshal([]byte(nextOptionsStr), &nextOptions); err != nil {
-		nextOptions = []string{nextOptionsStr}
+	// 完成相关的任务
+	if err := process(globalSessionManager, locale, id, summary); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
-	debugLog("📋 [MCP] 下一步选项: %v", nextOptions)
 
-	// 创建渲染任务并发送到Render通道（供web端显示）
+	// 创建渲染任务（通过事件推送给web端显示）
 	renderTask := RenderTask{
+		Id:           uuid.NewString(),
 		NextOptions:  nextOptions,
 		Summary:      summary,
 		Difficulties: difficulties,
+		SessionId:    sessionId,
+		CreatedAt:    time.Now(),
 	}
 	globalSessionManager.AddRenderTask(renderTask)
-	select {
-	case globalSessionManager.Render <- renderTask:
-		debugLog("📤 [MCP] 渲染任务已发送到Render通道")
-	default:
-		debugLog("⚠️  [MCP] Render通道已满")
-	}
+	// 调用结束后渲染任务已经没有等待者，从页面上清理掉
+	defer globalSessionManager.RemoveRenderTask(renderTask.Id)
+
+	// 客户端支持时同时通过 elicitation 在客户端界面上请求回答，先响应的渠道生效
+	stopElicitation := startElicitation(ctx, renderTask)
+	defer stopElicitation()
 
 	// 阻塞等待用户响应
-	debugLog("⏳ [MCP] 等待用户响应...")
-	response := <-globalSessionManager.Out
+	debugLog("⏳ [MCP] 等待用户响应... | 超时: %v", timeout)
+	response, err := globalSessionManager.WaitResponse(ctx, renderTask, timeout)
+	if err != nil {
+		if errors.Is(err, errWaitTimeout) {
+			debugLog("⌛ [MCP] 等待用户响应超时 | 耗时: %v | 兜底行为: %s", time.Since(startTime), onTimeout)
+			globalMetrics.ObserveWait("human_interaction", waitTimeout, time.Since(startTime))
+			result := HumanInteractionResult{
+				Decision:        decisionStop,
+				SelectedIndices: []int{},
+				SelectedOptions: []string{},
+				RenderTaskId:    renderTask.Id,
+				RequestedAt:     renderTask.CreatedAt,
+				WaitedMs:        time.Since(renderTask.CreatedAt).Milliseconds(),
+			}
+			if onTimeout == onTimeoutWait {
+				result.Decision = decisionTimeout
+				result.Continue = true
+			}
+			return mcp.NewToolResultStructured(result, timeoutPrompt(locale, onTimeout, timeout)), nil
+		}
+		debugLog("🔌 [MCP] 调用已取消，停止等待 | %v", err)
+		globalMetrics.ObserveWait("human_interaction", waitCancelled, time.Since(startTime))
+		return nil, err
+	}
+	response = globalSessionManager.formatResponse(response, renderTask.SessionId)
 	debugLog("✅ [MCP] 收到用户响应 | TaskID: %s | 输入: %s | 继续: %t", response.TaskId, response.CustomInput, response.Continue)
 
-	globalSessionManager.Taskmng.UpdateTask(response.TaskId, "processing", summary) // 更新任务状态为processing
+	globalSessionManager.Taskmng.ClaimTask(response.TaskId, renderTask.SessionId, response.CustomInput, summary) // 更新任务状态为processing
 
 	duration := time.Since(startTime)
 	debugLog("⏱️  [MCP] 人机交互请求处理完成 | 耗时: %v", duration)
+	globalMetrics.ObserveWait("human_interaction", waitAnswered, duration)
 	// 构建返回结果
-	var aiPrompt string
+	aiPrompt := globalI18n.Prompt(locale, "stop", InstructionData{})
 	if response.Continue {
-		aiPrompt = fmt.Sprintf(`【用户任务】
-%s
-
-【重要指令】
-1. 请立即执行上述用户任务
-2. 完成任务后，必须再次调用 human_interaction 工具向用户展示结果
-3. 调用参数：
- • summary: 你完成任务的总结
- • difficulties: 遇到的问题或困难
- • nextOptions: 建议的下一步选项（JSON数组格式）
- • taskId 请在完成之后,调用human_interaction工具的时候携带这个taskId: %s ,以便追踪和管理任务状态
-请记住：这是持续对话循环，每次完成任务后都要调用 human_interaction 工具！`,
-			response.CustomInput,
-			response.TaskId,
-		)
-	} else {
-		aiPrompt = `【对话结束】
-用户选择结束本次对话。
-请停止工作，不需要再调用任何工具。`
-	}
-
-	// 返回结构化结果 + AI提示
-	jsonData, _ := json.MarshalIndent(response, "", "  ")
-	return mcp.NewToolResultText(fmt.Sprintf("%s\n\n---\n\n用户响应数据（JSON）:\n%s",
+		aiPrompt = globalI18n.Prompt(locale, "continue", InstructionData{
+			Instruction: response.CustomInput,
+			TaskId:      response.TaskId,
+		})
+	}
+
+	// 返回结构化结果（structuredContent），文本内容保留AI提示和同样的JSON，兼容不支持结构化结果的客户端
+	result := newInteractionResult(renderTask, response)
+	jsonData, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultStructured(result, fmt.Sprintf("%s\n\n---\n\n%s\n%s",
 		aiPrompt,
+		globalI18n.Prompt(locale, "response_data", InstructionData{}),
 		string(jsonData),
 	)), nil
 }
 
+// timeoutPrompt 等待超时时返回给AI的兜底提示
+func timeoutPrompt(locale, onTimeout string, timeout time.Duration) string {
+	name := "timeout_wait"
+	if onTimeout == onTimeoutStop {
+		name = "timeout_stop"
+	}
+	return globalI18n.Prompt(locale, name, InstructionData{Timeout: timeout.String()})
+}
+
 // main 启动 MCP 服务器
 func main() {
+	cfg, err := LoadConfig(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "❌ 配置错误: %v\n", err)
+		os.Exit(2)
+	}
+	appConfig = cfg
+	if cfg.Transport == transportStdio {
+		console = os.Stderr
+	}
+	debugMode = cfg.Debug
+	globalPrompt.Set(cfg.Format) // 已在 Validate 中校验
+	globalI18n, _ = LoadI18n(cfg.PromptsDir, cfg.Locale)
+	globalSessionManager = NewSessionManager(cfg.QueueCapacity)
+	globalSigner = newApprovalSigner(cfg.ApprovalSecret)
+
 	// 初始化日志系统
 	if err := initLog(); err != nil {
-		fmt.Printf("⚠️  日志系统初始化失败: %v\n", err)
+		fmt.Fprintf(console, "⚠️  日志系统初始化失败: %v\n", err)
 	}
 	defer closeLog() // 确保程序退出时关闭日志文件
 
-	// 启动任务管理HTTP服务器
+	// 从持久化存储恢复任务队列
+	store := NewStore(cfg.StorePath)
+	if err := globalSessionManager.Restore(store); err != nil {
+		fmt.Fprintf(console, "⚠️  恢复持久化状态失败: %v\n", err)
+	}
+	defer store.Close()
+
+	// 启动任务管理HTTP服务器（所有传输方式下都会启动，供用户在浏览器中响应）
 	StartTaskServer()
 
-	mcpServer := server.NewMCPServer("human-in-mcp", "v1.0.0",
-		server.WithToolCapabilities(true))
-	mcpServer.AddTool(HumanInTool(), humanInteractionHandler)
-	sseServer := server.NewSSEServer(mcpServer,
-		server.WithKeepAlive(true), server.WithKeepAliveInterval(1*time.Hour))
-	mux := http.NewServeMux()
-	mux.Handle("/", sseServer)
-	fmt.Println("✅ Human-In-MCP Server running on http://localhost:8093")
-	fmt.Println("📝 任务管理页面: http://localhost:8094")
-	fmt.Println("📋 Debug日志文件: human_in_mcp_debug.log")
-	if err := http.ListenAndServe("localhost:8093", mux); err != nil {
-		panic(err)
+	var mcpServer *server.MCPServer
+	hooks := &server.Hooks{}
+	hooks.AddOnRegisterSession(func(ctx context.Context, session server.ClientSession) {
+		registerSession(ctx, mcpServer, session)
+	})
+	hooks.AddBeforeCallTool(func(ctx context.Context, id any, message *mcp.CallToolRequest) {
+		globalMetrics.ToolCall(message.Params.Name, sessionIdFromContext(ctx))
+	})
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		activeCalls.cancelSession(session.SessionID())
+		globalSessionManager.CloseSession(session.SessionID())
+		unregisterSession(session.SessionID())
+	})
+
+	serverOptions := []server.ServerOption{
+		server.WithToolCapabilities(true),
+		server.WithResourceCapabilities(false, true),
+		server.WithHooks(hooks),
+	}
+	if cfg.Elicitation {
+		serverOptions = append(serverOptions, server.WithElicitation())
+	}
+	mcpServer = server.NewMCPServer("human-in-mcp", "v1.0.0", serverOptions...)
+	mcpServer.AddTool(HumanInTool(cfg.Locale), humanInteractionHandler)
+	mcpServer.AddTool(HumanAskTool(cfg.Locale), humanAskHandler)
+	mcpServer.AddTool(HumanCheckTool(cfg.Locale), humanCheckHandler)
+	mcpServer.AddTool(HumanApproveTool(cfg.Locale), humanApproveHandler)
+	registerResources(mcpServer, cfg.Locale)
+	go notifyResourceUpdates(mcpServer)
+
+	if debugMode {
+		fmt.Fprintf(console, "📋 Debug日志文件: %s\n", cfg.LogPath)
+	}
+	switch cfg.Transport {
+	case transportStdio:
+		fmt.Fprintln(console, "✅ Human-In-MCP Server running on stdio")
+		if err := server.ServeStdio(mcpServer); err != nil {
+			fmt.Fprintf(console, "❌ stdio 服务异常退出: %v\n", err)
+		}
+	case transportHTTP:
+		httpServer := server.NewStreamableHTTPServer(mcpServer)
+		mux := http.NewServeMux()
+		mux.Handle("/mcp", withConnection(httpServer))
+		fmt.Fprintf(console, "✅ Human-In-MCP Server running on http://%s/mcp\n", cfg.MCPAddr)
+		if err := http.ListenAndServe(cfg.MCPAddr, mux); err != nil {
+			panic(err)
+		}
+	default:
+		sseServer := server.NewSSEServer(mcpServer,
+			server.WithKeepAlive(true), server.WithKeepAliveInterval(1*time.Hour))
+		mux := http.NewServeMux()
+		mux.Handle("/", withConnection(sseServer))
+		fmt.Fprintf(console, "✅ Human-In-MCP Server running on http://%s/sse\n", cfg.MCPAddr)
+		if err := http.ListenAndServe(cfg.MCPAddr, mux); err != nil {
+			panic(err)
+		}
 	}
 }
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 内置的多语言文案，每种语言一个 <locale>.yaml
+//
+//go:embed locales
+var embeddedLocales embed.FS
+
+// baseLocale 文案缺失时最终回退的语言，内置文案以中文为准
+const baseLocale = "zh"
+
+// messageCatalog 一种语言的全部文案
+type messageCatalog struct {
+	Prompts map[string]string `yaml:"prompts"` // 返回给AI的提示（text/template）
+	Tools   map[string]string `yaml:"tools"`   // 工具、参数和资源的说明，参数用 "工具名.参数名" 作为键
+	UI      map[string]string `yaml:"ui"`      // 任务管理页面及导出报告等给用户看的文案，{name} 为占位符
+}
+
+// InstructionData 提示模板可用的变量
+type InstructionData struct {
+	Instruction string // 用户指令（已经过格式化模板处理）
+	TaskId      string // 任务ID，AI完成后需要带回
+	Timeout     string // 等待超时时长
+	TicketId    string // 异步提问的 ticketId
+	Payload     string // 用户编辑后批准的审批内容
+	Comment     string // 用户的审批意见
+}
+
+// sampleInstructionData 校验提示模板时使用的示例数据
+var sampleInstructionData = InstructionData{
+	Instruction: "添加单元测试",
+	TaskId:      "0199f1a2-7c3e-7d4a-9b1f-2e8c5a6d4f10",
+	Timeout:     "10m0s",
+	TicketId:    "0199f1a2-8d4f-7e5b-a02c-3f9d6b7e5a21",
+	Payload:     "rm -rf ./build",
+	Comment:     "只删除 build 目录",
+}
+
+// I18n 多语言文案，启动时加载完成后只读
+type I18n struct {
+	fallback string // 配置中的默认语言
+	catalogs map[string]*messageCatalog
+	prompts  map[string]*template.Template // 键为 "语言/提示名"
+}
+
+// 全局文案，main 中按配置重新加载；内置文案一定能加载成功
+var globalI18n, _ = LoadI18n("", baseLocale)
+
+// LoadI18n 加载内置文案，再用 dir 目录中的 <locale>.yaml 逐条覆盖（也可以新增语言）
+func LoadI18n(dir, fallback string) (*I18n, error) {
+	i := &I18n{
+		fallback: normalizeLocale(fallback),
+		catalogs: make(map[string]*messageCatalog),
+		prompts:  make(map[string]*template.Template),
+	}
+
+	files, _ := fs.Sub(embeddedLocales, "locales")
+	if err := i.loadDir(files); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, fmt.Errorf("读取文案目录失败: %v", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s 不是目录", dir)
+		}
+		if err := i.loadDir(os.DirFS(dir)); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := i.catalogs[i.fallback]; !ok {
+		return nil, fmt.Errorf("不支持的语言 %q（可选 %s）", fallback, strings.Join(i.Locales(), " | "))
+	}
+	for locale, catalog := range i.catalogs {
+		for name, source := range catalog.Prompts {
+			tmpl, err := template.New(name).Option("missingkey=error").Parse(source)
+			if err == nil {
+				err = tmpl.Execute(&bytes.Buffer{}, sampleInstructionData)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s 的提示 %s 无效: %v", locale, name, err)
+			}
+			i.prompts[locale+"/"+name] = tmpl
+		}
+	}
+	return i, nil
+}
+
+// loadDir 加载目录下的所有 <locale>.yaml，已存在的语言逐条覆盖
+func (i *I18n) loadDir(files fs.FS) error {
+	names, err := fs.Glob(files, "*.yaml")
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		data, err := fs.ReadFile(files, name)
+		if err != nil {
+			return fmt.Errorf("读取文案 %s 失败: %v", name, err)
+		}
+		var catalog messageCatalog
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&catalog); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("解析文案 %s 失败: %v", name, err)
+		}
+
+		locale := normalizeLocale(strings.TrimSuffix(filepath.Base(name), ".yaml"))
+		current, ok := i.catalogs[locale]
+		if !ok {
+			current = &messageCatalog{Prompts: map[string]string{}, Tools: map[string]string{}, UI: map[string]string{}}
+			i.catalogs[locale] = current
+		}
+		for k, v := range catalog.Prompts {
+			current.Prompts[k] = v
+		}
+		for k, v := range catalog.Tools {
+			current.Tools[k] = v
+		}
+		for k, v := range catalog.UI {
+			current.UI[k] = v
+		}
+	}
+	return nil
+}
+
+// normalizeLocale 统一语言标识：en-US、en_US、en-US,en;q=0.9 都视为 en
+func normalizeLocale(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if idx := strings.IndexAny(locale, "-_,;"); idx >= 0 {
+		locale = locale[:idx]
+	}
+	return locale
+}
+
+// Locales 返回支持的语言列表
+func (i *I18n) Locales() []string {
+	locales := make([]string, 0, len(i.catalogs))
+	for locale := range i.catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Resolve 返回实际使用的语言，不支持的语言使用配置的默认语言
+func (i *I18n) Resolve(locale string) string {
+	if locale = normalizeLocale(locale); i.catalogs[locale] != nil {
+		return locale
+	}
+	return i.fallback
+}
+
+// chain 查找文案的顺序：请求的语言 → 配置的默认语言 → 中文
+func (i *I18n) chain(locale string) []string {
+	return []string{i.Resolve(locale), i.fallback, baseLocale}
+}
+
+// Prompt 渲染返回给AI的提示
+func (i *I18n) Prompt(locale, name string, data InstructionData) string {
+	for _, l := range i.chain(locale) {
+		tmpl := i.prompts[l+"/"+name]
+		if tmpl == nil {
+			continue
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, data); err != nil {
+			debugLog("❌ [I18n] 提示渲染失败 | 语言: %s | 提示: %s | %v", l, name, err)
+			continue
+		}
+		return out.String()
+	}
+	return name
+}
+
+// Tool 返回工具或参数的说明
+func (i *I18n) Tool(locale, key string) string {
+	for _, l := range i.chain(locale) {
+		if text, ok := i.catalogs[l].Tools[key]; ok {
+			return text
+		}
+	}
+	return key
+}
+
+// Text 返回服务端生成的给用户看的文案（导出报告、任务记录等），与页面文案共用 ui 部分
+// args 为成对的占位符名和取值，替换文案中的 {name}
+func (i *I18n) Text(locale, key string, args ...string) string {
+	text := key
+	for _, l := range i.chain(locale) {
+		if v, ok := i.catalogs[l].UI[key]; ok {
+			text = v
+			break
+		}
+	}
+	pairs := make([]string, 0, len(args))
+	for idx := 0; idx+1 < len(args); idx += 2 {
+		pairs = append(pairs, "{"+args[idx]+"}", args[idx+1])
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// UI 返回页面文案，缺失的条目用回退语言补齐
+func (i *I18n) UI(locale string) map[string]string {
+	chain := i.chain(locale)
+	messages := make(map[string]string)
+	for idx := len(chain) - 1; idx >= 0; idx-- {
+		if catalog := i.catalogs[chain[idx]]; catalog != nil {
+			for k, v := range catalog.UI {
+				messages[k] = v
+			}
+		}
+	}
+	return messages
+}
+
+// localeFromContext 返回当前调用使用的语言：请求指定 → 会话指定 → 配置
+func localeFromContext(ctx context.Context) string {
+	if locale := connectionFromContext(ctx).Locale; locale != "" {
+		return globalI18n.Resolve(locale)
+	}
+	return globalI18n.fallback
+}
+
+// requestLocale 返回页面请求使用的语言：?locale= → Accept-Language → 配置
+func requestLocale(r *http.Request) string {
+	if locale := r.URL.Query().Get("locale"); locale != "" {
+		return globalI18n.Resolve(locale)
+	}
+	return globalI18n.Resolve(r.Header.Get("Accept-Language"))
+}
+
+// sessionLocale 返回会话使用的语言，用于没有调用上下文的页面响应
+func sessionLocale(sessionId string) string {
+	if locale := sessionConnection(sessionId).Locale; locale != "" {
+		return locale
+	}
+	return globalI18n.fallback
+}
+
+// handleI18n 返回页面文案
+// GET /api/i18n?locale=en
+func handleI18n(w http.ResponseWriter, r *http.Request) {
+	locale := globalI18n.Resolve(r.URL.Query().Get("locale"))
+	locales := make([]map[string]string, 0)
+	for _, l := range globalI18n.Locales() {
+		name := globalI18n.catalogs[l].UI["language.name"]
+		if name == "" {
+			name = l
+		}
+		locales = append(locales, map[string]string{"locale": l, "name": name})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"locale":   locale,
+		"locales":  locales,
+		"messages": globalI18n.UI(locale),
+	})
+}
@@ -1,15 +1,49 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"sync"
 
-var insIdGen = IdGenerator()
+	"github.com/google/uuid"
+)
 
-func IdGenerator() func() string {
-	var a int
-	a = 0
+// 全局任务ID生成器，SessionManager.Restore 恢复状态后重新设置别名编号
+var insIdGen = NewIdGenerator(0)
 
-	return func() string {
-		a++
-		return fmt.Sprintf("id-%d", a)
+// IdGenerator 并发安全的任务ID生成器
+// ID 为 UUIDv7：按生成时间排序，跨重启全局唯一，AI 带回旧的 taskId 不会命中新任务；
+// 别名为递增的短编号（T-1、T-2…），便于在页面和对话中引用，恢复持久化状态后从用过的最大编号之后继续，
+// 已删除或清空的任务的别名也不会复用，AI 带回旧别名不会命中新任务
+type IdGenerator struct {
+	mu  sync.Mutex
+	seq int
+}
+
+// NewIdGenerator 从指定别名编号之后继续生成
+func NewIdGenerator(start int) *IdGenerator {
+	return &IdGenerator{seq: start}
+}
+
+// Next 生成新的任务ID和别名
+func (g *IdGenerator) Next() (id, alias string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.seq++
+	return uuid.Must(uuid.NewV7()).String(), fmt.Sprintf("T-%d", g.seq)
+}
+
+// Reseed 把别名编号设置为用过的最大编号，只会增大
+func (g *IdGenerator) Reseed(seq int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.seq = max(g.seq, seq)
+}
+
+// aliasSeq 返回别名的编号，不是 T-<n> 格式时返回 0
+func aliasSeq(alias string) int {
+	var n int
+	if _, err := fmt.Sscanf(alias, "T-%d", &n); err != nil {
+		return 0
 	}
+	return n
 }
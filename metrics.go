@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prometheus 指标，按文本格式（version 0.0.4）手写输出，不引入客户端库
+// 队列深度、渲染任务和任务数量在抓取时现算；等待时长、丢弃的响应和工具调用次数随调用累加
+
+// 等待用户响应时长的直方图分桶（秒）
+var waitBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600}
+
+// 等待用户响应的结果
+const (
+	waitAnswered  = "answered"  // 收到用户响应
+	waitTimeout   = "timeout"   // 等待超时
+	waitCancelled = "cancelled" // 调用被取消或会话断开
+)
+
+// 响应被丢弃或拒绝的原因
+const (
+	dropQueueFull    = "queue_full"    // 队列已满，新指令被拒绝
+	dropApprovalGone = "approval_gone" // 审批调用已经结束，审批结论无法送达
+)
+
+// histogram 累计分桶的直方图
+type histogram struct {
+	buckets []uint64 // 与 waitBuckets 一一对应，记录 <= 上界的次数
+	count   uint64
+	sum     float64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, le := range waitBuckets {
+		if v <= le {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// waitKey 等待时长按工具和结果分组
+type waitKey struct {
+	tool    string
+	outcome string
+}
+
+// Metrics 随调用累加的指标
+type Metrics struct {
+	mu           sync.Mutex
+	waits        map[waitKey]*histogram
+	dropped      map[string]uint64            // 原因 -> 次数
+	toolCalls    map[string]uint64            // 工具 -> 调用次数
+	sessionCalls map[string]map[string]uint64 // 会话ID -> 工具 -> 调用次数，会话结束后移除
+}
+
+var globalMetrics = NewMetrics()
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		waits:        make(map[waitKey]*histogram),
+		dropped:      make(map[string]uint64),
+		toolCalls:    make(map[string]uint64),
+		sessionCalls: make(map[string]map[string]uint64),
+	}
+}
+
+// ObserveWait 记录一次等待用户响应的时长
+func (m *Metrics) ObserveWait(tool, outcome string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := waitKey{tool, outcome}
+	h, ok := m.waits[key]
+	if !ok {
+		h = &histogram{buckets: make([]uint64, len(waitBuckets))}
+		m.waits[key] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// Drop 记录被丢弃或拒绝的响应
+func (m *Metrics) Drop(reason string, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dropped[reason] += uint64(n)
+}
+
+// ToolCall 记录一次工具调用，stdio 等没有会话ID的调用只计入总数
+func (m *Metrics) ToolCall(tool, sessionId string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.toolCalls[tool]++
+	if sessionId == "" {
+		return
+	}
+	calls, ok := m.sessionCalls[sessionId]
+	if !ok {
+		calls = make(map[string]uint64)
+		m.sessionCalls[sessionId] = calls
+	}
+	calls[tool]++
+}
+
+// ForgetSession 会话结束时移除它的调用计数，避免会话ID无限增长
+func (m *Metrics) ForgetSession(sessionId string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessionCalls, sessionId)
+}
+
+// metricsWriter 按 Prometheus 文本格式输出
+type metricsWriter struct {
+	w io.Writer
+}
+
+func (mw metricsWriter) header(name, kind, help string) {
+	fmt.Fprintf(mw.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample 输出一个样本，labels 为成对的标签名和取值
+func (mw metricsWriter) sample(name string, value float64, labels ...string) {
+	fmt.Fprintf(mw.w, "%s%s %s\n", name, formatLabels(labels), strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+labelEscaper.Replace(labels[i+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// sortedKeys 返回排序后的键，保证每次输出的顺序一致
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeQueueMetrics 输出共享队列和各会话队列中等待领取的指令数，以及各类等待用户处理的渲染任务数
+func (sm *SessionManager) writeQueueMetrics(mw metricsWriter) {
+	sm.mu.RLock()
+	depths := make(map[string]int, len(sm.sessionOut))
+	for id, q := range sm.sessionOut {
+		depths[id] = q.Len()
+	}
+	shared := sm.Out.Len()
+	kinds := map[string]int{"interaction": 0, renderKindAsk: 0, renderKindApprove: 0}
+	for _, task := range sm.renderTasks {
+		kind := task.Kind
+		if kind == "" {
+			kind = "interaction"
+		}
+		kinds[kind]++
+	}
+	sm.mu.RUnlock()
+
+	mw.header("human_in_mcp_queue_depth", "gauge", "Responses waiting to be claimed, by queue (shared Out queue or a session queue).")
+	mw.sample("human_in_mcp_queue_depth", float64(shared), "queue", "shared")
+	for _, id := range sortedKeys(depths) {
+		mw.sample("human_in_mcp_queue_depth", float64(depths[id]), "queue", "session", "session", id)
+	}
+
+	mw.header("human_in_mcp_render_tasks_pending", "gauge", "Agent requests shown on the task page and waiting for the user, by kind.")
+	for _, kind := range sortedKeys(kinds) {
+		mw.sample("human_in_mcp_render_tasks_pending", float64(kinds[kind]), "kind", kind)
+	}
+}
+
+// writeTaskMetrics 输出各状态的任务数
+func (tm *TaskManager) writeTaskMetrics(mw metricsWriter) {
+	tm.mu.RLock()
+	counts := map[string]int{"pending": 0, "processing": 0, "completed": 0}
+	for _, task := range tm.tasks {
+		counts[task.Status]++
+	}
+	tm.mu.RUnlock()
+
+	mw.header("human_in_mcp_tasks", "gauge", "Tasks by status.")
+	for _, status := range sortedKeys(counts) {
+		mw.sample("human_in_mcp_tasks", float64(counts[status]), "status", status)
+	}
+}
+
+// writeMetrics 输出累加的指标
+func (m *Metrics) writeMetrics(mw metricsWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mw.header("human_in_mcp_human_wait_seconds", "histogram", "Time a tool call waited for the human, by tool and outcome.")
+	keys := make([]waitKey, 0, len(m.waits))
+	for key := range m.waits {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].tool != keys[j].tool {
+			return keys[i].tool < keys[j].tool
+		}
+		return keys[i].outcome < keys[j].outcome
+	})
+	for _, key := range keys {
+		h := m.waits[key]
+		for i, le := range waitBuckets {
+			mw.sample("human_in_mcp_human_wait_seconds_bucket", float64(h.buckets[i]),
+				"tool", key.tool, "outcome", key.outcome, "le", strconv.FormatFloat(le, 'g', -1, 64))
+		}
+		mw.sample("human_in_mcp_human_wait_seconds_bucket", float64(h.count), "tool", key.tool, "outcome", key.outcome, "le", "+Inf")
+		mw.sample("human_in_mcp_human_wait_seconds_sum", h.sum, "tool", key.tool, "outcome", key.outcome)
+		mw.sample("human_in_mcp_human_wait_seconds_count", float64(h.count), "tool", key.tool, "outcome", key.outcome)
+	}
+
+	mw.header("human_in_mcp_responses_dropped_total", "counter", "Responses rejected or dropped, by reason.")
+	dropped := map[string]uint64{dropQueueFull: m.dropped[dropQueueFull], dropApprovalGone: m.dropped[dropApprovalGone]}
+	for _, reason := range sortedKeys(dropped) {
+		mw.sample("human_in_mcp_responses_dropped_total", float64(dropped[reason]), "reason", reason)
+	}
+
+	mw.header("human_in_mcp_tool_calls_total", "counter", "MCP tool calls, by tool.")
+	for _, tool := range sortedKeys(m.toolCalls) {
+		mw.sample("human_in_mcp_tool_calls_total", float64(m.toolCalls[tool]), "tool", tool)
+	}
+
+	mw.header("human_in_mcp_session_tool_calls_total", "counter", "MCP tool calls of each connected session, by tool. Removed when the session ends.")
+	for _, id := range sortedKeys(m.sessionCalls) {
+		calls := m.sessionCalls[id]
+		for _, tool := range sortedKeys(calls) {
+			mw.sample("human_in_mcp_session_tool_calls_total", float64(calls[tool]), "session", id, "tool", tool)
+		}
+	}
+}
+
+// handleMetrics 处理 GET /metrics
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	mw := metricsWriter{w: w}
+	globalSessionManager.writeQueueMetrics(mw)
+	globalSessionManager.Taskmng.writeTaskMetrics(mw)
+	globalMetrics.writeMetrics(mw)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 选项风险等级
+const (
+	riskLow    = "low"
+	riskMedium = "medium"
+	riskHigh   = "high"
+)
+
+// NextOption AI 提供的下一步选项
+// JSON 中既可以是普通字符串（只有 label），也可以是带说明和标记的对象
+type NextOption struct {
+	Label       string `json:"label"`                 // 选项文本，用户选中后作为指令发给AI
+	Description string `json:"description,omitempty"` // 补充说明，页面上显示在选项下方
+	Risk        string `json:"risk,omitempty"`        // 风险等级: low | medium | high
+	Recommended bool   `json:"recommended,omitempty"` // AI 推荐的选项
+	Default     bool   `json:"default,omitempty"`     // 默认选项，页面上预先选中
+}
+
+// UnmarshalJSON 兼容字符串形式的选项（旧的持久化数据和旧的调用方式）
+func (o *NextOption) UnmarshalJSON(data []byte) error {
+	var label string
+	if err := json.Unmarshal(data, &label); err == nil {
+		*o = NextOption{Label: label}
+		return nil
+	}
+
+	type plain NextOption
+	var opt plain
+	if err := json.Unmarshal(data, &opt); err != nil {
+		return err
+	}
+	*o = NextOption(opt)
+	return nil
+}
+
+// nextOptionsSchema nextOptions 参数的元素定义：字符串或选项对象，说明文案使用指定语言
+func nextOptionsSchema(locale string) map[string]any {
+	desc := func(key string) string { return globalI18n.Tool(locale, "nextOptions."+key) }
+	return map[string]any{
+		"anyOf": []any{
+			map[string]any{"type": "string"},
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"label":       map[string]any{"type": "string", "description": desc("label")},
+					"description": map[string]any{"type": "string", "description": desc("description")},
+					"risk":        map[string]any{"type": "string", "enum": []string{riskLow, riskMedium, riskHigh}, "description": desc("risk")},
+					"recommended": map[string]any{"type": "boolean", "description": desc("recommended")},
+					"default":     map[string]any{"type": "boolean", "description": desc("default")},
+				},
+				"required": []string{"label"},
+			},
+		},
+	}
+}
+
+// parseNextOptions 解析工具调用中的 nextOptions 参数
+// 支持原生数组（元素为字符串或对象）和旧的 JSON 字符串；字符串无法解析为数组时整体作为一个选项
+func parseNextOptions(raw any) ([]NextOption, error) {
+	var options []NextOption
+	switch v := raw.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if err := json.Unmarshal([]byte(v), &options); err != nil {
+			return []NextOption{{Label: v}}, nil
+		}
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &options); err != nil {
+			return nil, fmt.Errorf("nextOptions 格式错误，元素必须是字符串或包含 label 的对象: %v", err)
+		}
+	}
+
+	hasDefault := false
+	for i := range options {
+		opt := &options[i]
+		opt.Label = strings.TrimSpace(opt.Label)
+		if opt.Label == "" {
+			return nil, fmt.Errorf("nextOptions 第 %d 项的 label 不能为空", i+1)
+		}
+		switch opt.Risk {
+		case "", riskLow, riskMedium, riskHigh:
+		default:
+			return nil, fmt.Errorf("nextOptions 第 %d 项的 risk 不支持 %q（可选 low | medium | high）", i+1, opt.Risk)
+		}
+		if opt.Default {
+			if hasDefault {
+				return nil, fmt.Errorf("nextOptions 最多只能有一个 default 选项")
+			}
+			hasDefault = true
+		}
+	}
+	return options, nil
+}
+
+// optionLabels 返回选项文本列表
+func optionLabels(options []NextOption) []string {
+	labels := make([]string, len(options))
+	for i, opt := range options {
+		labels[i] = opt.Label
+	}
+	return labels
+}
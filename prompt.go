@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// PromptData 格式化模板可用的变量
+type PromptData struct {
+	Input    string   // 用户输入，多选时为按顺序整理好的完整指令
+	Selected string   // 用户选择的选项，多个时用 "；" 连接
+	Options  []string // 用户选择的选项，按执行顺序排列
+	Note     string   // 用户附加的补充说明
+	Summary  string   // 用户回答的渲染任务中AI给出的总结，手动添加的任务为空
+	TaskId   string   // 任务ID
+	Alias    string   // 任务别名（T-1、T-2…）
+	Session  string   // 领取指令的MCP会话ID
+	Date     string   // 当前日期 2006-01-02
+	Time     string   // 当前时间 15:04:05
+	Cwd      string   // 服务进程的工作目录
+}
+
+// promptVariables 页面上展示的变量说明，与 PromptData 的字段一一对应
+func promptVariables(locale string) []map[string]string {
+	desc := func(key string) string { return globalI18n.Text(locale, "format.var."+key) }
+	return []map[string]string{
+		{"name": "{{.Input}}", "description": desc("input")},
+		{"name": "{{.Selected}}", "description": desc("selected")},
+		{"name": "{{range .Options}}…{{end}}", "description": desc("options")},
+		{"name": "{{.Note}}", "description": desc("note")},
+		{"name": "{{.Summary}}", "description": desc("summary")},
+		{"name": "{{.TaskId}} / {{.Alias}}", "description": desc("taskId")},
+		{"name": "{{.Session}}", "description": desc("session")},
+		{"name": "{{.Date}} / {{.Time}}", "description": desc("dateTime")},
+		{"name": "{{.Cwd}}", "description": desc("cwd")},
+	}
+}
+
+// newPromptData 根据用户响应构建模板变量
+func newPromptData(resp UserChoiceResponse, alias string) PromptData {
+	now := time.Now()
+	cwd, _ := os.Getwd()
+	return PromptData{
+		Input:    resp.CustomInput,
+		Selected: strings.Join(resp.SelectedOptions, "；"),
+		Options:  resp.SelectedOptions,
+		Note:     resp.Note,
+		Summary:  resp.Summary,
+		TaskId:   resp.TaskId,
+		Alias:    alias,
+		Session:  resp.SessionId,
+		Date:     now.Format(time.DateOnly),
+		Time:     now.Format(time.TimeOnly),
+		Cwd:      cwd,
+	}
+}
+
+// samplePromptData 校验和预览模板时使用的示例数据
+func samplePromptData(input string) PromptData {
+	if input == "" {
+		input = "添加单元测试"
+	}
+	data := newPromptData(UserChoiceResponse{
+		CustomInput:     input,
+		SelectedOptions: []string{"添加单元测试", "提交代码"},
+		Note:            "先跑测试再提交",
+		Summary:         "已完成登录接口的重构",
+		TaskId:          "0199f1a2-7c3e-7d4a-9b1f-2e8c5a6d4f10",
+	}, "T-1")
+	return data
+}
+
+// legacyPrompt 兼容旧版本的 fmt 格式化字符串：不含 {{ 时把 %s 换成 {{.Input}}，%% 换成 %
+func legacyPrompt(source string) string {
+	if strings.Contains(source, "{{") || !strings.Contains(source, "%s") {
+		return source
+	}
+	source = strings.ReplaceAll(source, "%s", "{{.Input}}")
+	return strings.ReplaceAll(source, "%%", "%")
+}
+
+// parsePrompt 解析格式化模板，并用示例数据试渲染一次，确保引用的变量都存在
+func parsePrompt(source string) (*template.Template, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, fmt.Errorf("格式化模板不能为空")
+	}
+	tmpl, err := template.New("format").Option("missingkey=error").Parse(legacyPrompt(source))
+	if err != nil {
+		return nil, fmt.Errorf("模板语法错误: %v", err)
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, samplePromptData("")); err != nil {
+		return nil, fmt.Errorf("模板渲染失败: %v", err)
+	}
+	return tmpl, nil
+}
+
+// PreviewPrompt 用示例数据渲染模板，返回渲染结果和指定语言的提示（例如没有输出用户输入）
+func PreviewPrompt(locale, source, input string) (string, []string, error) {
+	tmpl, err := parsePrompt(source)
+	if err != nil {
+		return "", nil, err
+	}
+	data := samplePromptData(input)
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", nil, fmt.Errorf("模板渲染失败: %v", err)
+	}
+	warnings := make([]string, 0)
+	if !strings.Contains(out.String(), data.Input) {
+		warnings = append(warnings, globalI18n.Text(locale, "format.warnNoInput"))
+	}
+	return out.String(), warnings, nil
+}
+
+// PromptFormatter 当前生效的格式化模板，页面修改和任务入队可能并发，读写都需要加锁
+type PromptFormatter struct {
+	mu     sync.RWMutex
+	source string
+	tmpl   *template.Template
+}
+
+// 全局格式化模板，启动时由配置覆盖
+var globalPrompt = NewPromptFormatter()
+
+func NewPromptFormatter() *PromptFormatter {
+	tmpl, _ := parsePrompt("{{.Input}}")
+	return &PromptFormatter{source: "{{.Input}}", tmpl: tmpl}
+}
+
+// Set 校验并替换格式化模板，校验失败时保持原模板不变
+func (p *PromptFormatter) Set(source string) error {
+	tmpl, err := parsePrompt(source)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.source = source
+	p.tmpl = tmpl
+	p.mu.Unlock()
+	return nil
+}
+
+// Source 返回当前模板的原文
+func (p *PromptFormatter) Source() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.source
+}
+
+// Render 用全局格式化模板渲染用户输入
+func (p *PromptFormatter) Render(data PromptData) string {
+	p.mu.RLock()
+	tmpl := p.tmpl
+	p.mu.RUnlock()
+
+	return renderPrompt(tmpl, data)
+}
+
+// renderPrompt 渲染模板，渲染失败时原样返回用户输入，不能让指令丢失
+func renderPrompt(tmpl *template.Template, data PromptData) string {
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		debugLog("❌ [Prompt] 模板渲染失败，使用原始输入 | TaskID: %s | %v", data.TaskId, err)
+		return data.Input
+	}
+	return out.String()
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+// 队列已满，新的指令不会被记录
+var errQueueFull = errors.New("response queue is full")
+
+// responseQueue 等待AI领取的响应队列
+// 与 FIFO 的 chan 不同，Pop 按任务的调度顺序（置顶 > 优先级 > 手动排列的顺序）取出最靠前的响应，
+// 调度顺序在取出时从 TaskManager 读取，调整优先级或拖动排序后立即生效
+//
+// 队列中的响应与 TaskManager 中 pending 状态且尚未被领取的任务一一对应：
+// 删除或清空任务时同步移出队列，重启时由 SessionManager.Restore 根据持久化的任务和响应重建
+type responseQueue struct {
+	mu       sync.Mutex
+	items    []UserChoiceResponse
+	capacity int           // 容量，只限制新指令的入队（见 Admit），0 表示不限制
+	tasks    *TaskManager  // 提供任务的调度顺序
+	ready    chan struct{} // 有响应可领取时发出信号，容量为1，多次入队合并为一个信号
+}
+
+func newResponseQueue(capacity int, tasks *TaskManager) *responseQueue {
+	return &responseQueue{
+		items:    make([]UserChoiceResponse, 0),
+		capacity: capacity,
+		tasks:    tasks,
+		ready:    make(chan struct{}, 1),
+	}
+}
+
+// Admit 检查是否还能接收 n 条新的指令，放不下时返回 errQueueFull
+func (q *responseQueue) Admit(n int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.capacity > 0 && len(q.items)+n > q.capacity {
+		return errQueueFull
+	}
+	return nil
+}
+
+// Push 入队，不检查容量
+// 新指令在入队前已经通过 Admit 检查，放回被取消的调用取出的响应、会话关闭时转移的响应等都必须入队，不能丢弃
+func (q *responseQueue) Push(resp UserChoiceResponse) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(q.items, resp)
+	q.signal()
+}
+
+// Pop 取出调度顺序最靠前的响应，队列为空时返回 false
+// nil 队列（调用方没有会话）视为空队列
+func (q *responseQueue) Pop() (UserChoiceResponse, bool) {
+	if q == nil {
+		return UserChoiceResponse{}, false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return UserChoiceResponse{}, false
+	}
+
+	ranks := q.tasks.dispatchRanks()
+	best := 0
+	for i := 1; i < len(q.items); i++ {
+		if ranks.before(q.items[i].TaskId, q.items[best].TaskId) {
+			best = i
+		}
+	}
+	resp := q.items[best]
+	q.items = append(q.items[:best], q.items[best+1:]...)
+	// 信号是合并的，还有剩余响应时继续通知其他等待者
+	if len(q.items) > 0 {
+		q.signal()
+	}
+	return resp, true
+}
+
+// Remove 移出指定任务的响应
+func (q *responseQueue) Remove(taskId string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, resp := range q.items {
+		if resp.TaskId == taskId {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Drain 取出所有响应
+func (q *responseQueue) Drain() []UserChoiceResponse {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := q.items
+	q.items = make([]UserChoiceResponse, 0)
+	return items
+}
+
+// Len 当前排队的响应数
+func (q *responseQueue) Len() int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Ready 有响应入队时可读，nil 队列返回 nil 通道（永远阻塞）
+func (q *responseQueue) Ready() <-chan struct{} {
+	if q == nil {
+		return nil
+	}
+	return q.ready
+}
+
+// signal 发出可领取信号（调用方需持有锁）
+func (q *responseQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// dispatchRank 任务的调度顺序
+type dispatchRank struct {
+	pinned   bool
+	priority int
+	index    int // 在任务列表中的位置，即手动排列的顺序
+}
+
+// dispatchRanks 任务ID -> 调度顺序，不在任务列表中的任务排在最后
+type dispatchRanks map[string]dispatchRank
+
+// before a 是否应该先于 b 被领取
+func (r dispatchRanks) before(a, b string) bool {
+	ra, okA := r[a]
+	rb, okB := r[b]
+	if okA != okB {
+		return okA
+	}
+	if ra.pinned != rb.pinned {
+		return ra.pinned
+	}
+	if ra.priority != rb.priority {
+		return ra.priority > rb.priority
+	}
+	return ra.index < rb.index
+}
@@ -0,0 +1,125 @@
+package main
+
+import "testing"
+
+// queueWith 创建一个队列，任务按给定顺序加入 TaskManager 并入队
+func queueWith(capacity int, taskIds ...string) *responseQueue {
+	tasks := NewTaskManager()
+	q := newResponseQueue(capacity, tasks)
+	for _, id := range taskIds {
+		tasks.AddTask(TaskStatus{TaskId: id, Status: "pending"})
+		q.Push(UserChoiceResponse{TaskId: id})
+	}
+	return q
+}
+
+// popAll 依次取出队列中的所有任务ID
+func popAll(q *responseQueue) []string {
+	var ids []string
+	for {
+		resp, ok := q.Pop()
+		if !ok {
+			return ids
+		}
+		ids = append(ids, resp.TaskId)
+	}
+}
+
+func TestResponseQueueDispatchOrder(t *testing.T) {
+	q := queueWith(0, "a", "b", "c", "d", "e")
+	// 不在任务列表中的响应排在最后
+	q.Push(UserChoiceResponse{TaskId: "unknown"})
+
+	high, low := 5, -1
+	pinned := true
+	q.tasks.SetPriority("d", &high, nil)
+	q.tasks.SetPriority("b", &low, nil)
+	q.tasks.SetPriority("e", nil, &pinned)
+	if err := q.tasks.Reorder([]string{"c", "a"}); err != nil {
+		t.Fatalf("Reorder: %v", err)
+	}
+
+	// 置顶 > 优先级 > 手动排列的顺序
+	want := []string{"e", "d", "c", "a", "b", "unknown"}
+	got := popAll(q)
+	if len(got) != len(want) {
+		t.Fatalf("popped %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("popped %v, want %v", got, want)
+		}
+	}
+}
+
+func TestResponseQueueOrderChangesApplyImmediately(t *testing.T) {
+	q := queueWith(0, "a", "b", "c")
+	if resp, _ := q.Pop(); resp.TaskId != "a" {
+		t.Fatalf("Pop = %s, want a", resp.TaskId)
+	}
+	// 已入队的响应在调整优先级后按新的顺序取出
+	high := 1
+	q.tasks.SetPriority("c", &high, nil)
+	if resp, _ := q.Pop(); resp.TaskId != "c" {
+		t.Errorf("Pop after raising c = %s, want c", resp.TaskId)
+	}
+}
+
+func TestResponseQueueAdmit(t *testing.T) {
+	q := queueWith(3, "a", "b")
+	if err := q.Admit(1); err != nil {
+		t.Errorf("Admit(1) with 2/3 = %v, want nil", err)
+	}
+	if err := q.Admit(2); err != errQueueFull {
+		t.Errorf("Admit(2) with 2/3 = %v, want errQueueFull", err)
+	}
+	// Push 不检查容量，超出后 Admit 继续拒绝，取出后恢复
+	q.Push(UserChoiceResponse{TaskId: "c"})
+	q.Push(UserChoiceResponse{TaskId: "d"})
+	if err := q.Admit(1); err != errQueueFull {
+		t.Errorf("Admit(1) with 4/3 = %v, want errQueueFull", err)
+	}
+	q.Pop()
+	q.Pop()
+	if err := q.Admit(1); err != nil {
+		t.Errorf("Admit(1) after popping = %v, want nil", err)
+	}
+
+	if err := queueWith(0, "a", "b").Admit(100); err != nil {
+		t.Errorf("Admit on unlimited queue = %v, want nil", err)
+	}
+}
+
+func TestPushResponsesRejectsWholeBatch(t *testing.T) {
+	prevIdGen := insIdGen
+	insIdGen = NewIdGenerator(0)
+	t.Cleanup(func() { insIdGen = prevIdGen })
+
+	sm := NewSessionManager(3)
+	if _, err := sm.PushResponse(UserChoiceResponse{CustomInput: "first", Continue: true, SelectedIndex: -1}); err != nil {
+		t.Fatalf("PushResponse: %v", err)
+	}
+	batch := []UserChoiceResponse{
+		{CustomInput: "second", Continue: true, SelectedIndex: -1},
+		{CustomInput: "third", Continue: true, SelectedIndex: -1},
+		{CustomInput: "fourth", Continue: true, SelectedIndex: -1},
+	}
+	// 放不下整批时一条都不记录
+	if _, err := sm.PushResponses(batch); err != errQueueFull {
+		t.Fatalf("PushResponses = %v, want errQueueFull", err)
+	}
+	if n := sm.Out.Len(); n != 1 {
+		t.Errorf("queued = %d, want 1", n)
+	}
+	if n := len(sm.Taskmng.SnapshotTasks()); n != 1 {
+		t.Errorf("tasks = %d, want 1", n)
+	}
+
+	ids, err := sm.PushResponses(batch[:2])
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("PushResponses = %v, %v, want 2 ids", ids, err)
+	}
+	if _, err := sm.PushResponse(UserChoiceResponse{CustomInput: "fifth", Continue: true, SelectedIndex: -1}); err != errQueueFull {
+		t.Errorf("PushResponse on full queue = %v, want errQueueFull", err)
+	}
+}
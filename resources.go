@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// MCP 资源地址
+const (
+	resourceTasks        = "human://tasks"
+	resourceTaskTemplate = "human://tasks/{id}"
+	resourceHistory      = "human://history"
+)
+
+// taskDetail human://tasks/{id} 的内容：任务状态及用户当时的完整响应
+type taskDetail struct {
+	Task     TaskStatus          `json:"task"`
+	Response *UserChoiceResponse `json:"response,omitempty"`
+}
+
+// registerResources 注册任务队列和历史决策资源，让AI在再次询问前先查看用户之前的决定
+func registerResources(s *server.MCPServer, locale string) {
+	resources, templates := localizedResources(locale)
+	s.AddResources(resources...)
+	s.AddResourceTemplates(templates...)
+}
+
+// localizedResources 返回资源定义，名称和说明使用指定语言
+func localizedResources(locale string) ([]server.ServerResource, []server.ServerResourceTemplate) {
+	text := func(key string) string { return globalI18n.Tool(locale, "resources."+key) }
+	resources := []server.ServerResource{
+		{
+			Resource: mcp.NewResource(resourceTasks, text("tasks"),
+				mcp.WithResourceDescription(text("tasks.description")),
+				mcp.WithMIMEType("application/json")),
+			Handler: handleTasksResource,
+		},
+		{
+			Resource: mcp.NewResource(resourceHistory, text("history"),
+				mcp.WithResourceDescription(text("history.description")),
+				mcp.WithMIMEType("application/json")),
+			Handler: handleHistoryResource,
+		},
+	}
+	templates := []server.ServerResourceTemplate{
+		{
+			Template: mcp.NewResourceTemplate(resourceTaskTemplate, text("task"),
+				mcp.WithTemplateDescription(text("task.description")),
+				mcp.WithTemplateMIMEType("application/json")),
+			Handler: handleTaskResource,
+		},
+	}
+	return resources, templates
+}
+
+func handleTasksResource(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	tasks := globalSessionManager.Taskmng.SnapshotTasks()
+	return jsonResource(req.Params.URI, tasks)
+}
+
+func handleTaskResource(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	id := strings.TrimPrefix(req.Params.URI, resourceTasks+"/")
+	task, ok := globalSessionManager.Taskmng.SnapshotTask(id)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", server.ErrResourceNotFound, globalI18n.Prompt(localeFromContext(ctx), "resource_task_not_found", InstructionData{TaskId: id}))
+	}
+
+	detail := taskDetail{Task: task}
+	for _, resp := range globalSessionManager.GetResponses() {
+		if resp.TaskId == task.TaskId {
+			detail.Response = &resp
+			break
+		}
+	}
+	return jsonResource(req.Params.URI, detail)
+}
+
+func handleHistoryResource(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	return jsonResource(req.Params.URI, globalSessionManager.GetResponses())
+}
+
+// jsonResource 把数据序列化为 JSON 文本资源
+func jsonResource(uri string, v any) ([]mcp.ResourceContents, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{
+		mcp.TextResourceContents{URI: uri, MIMEType: "application/json", Text: string(data)},
+	}, nil
+}
+
+// notifyResourceUpdates 订阅内部事件，任务或历史响应变化时向所有MCP会话发送 notifications/resources/list_changed
+// mcp-go 没有实现 resources/subscribe，服务只声明 listChanged 能力，客户端收到通知后重新读取资源
+func notifyResourceUpdates(s *server.MCPServer) {
+	var lastEventId int64
+	for {
+		ch, replay, resync := globalEvents.Subscribe(lastEventId)
+		if resync {
+			// 重新订阅期间丢失了事件，不知道资源是否变化，按变化处理
+			sendResourcesListChanged(s)
+		}
+		for _, event := range replay {
+			lastEventId = event.Id
+			handleResourceEvent(s, event)
+		}
+		// 消费过慢被断开时通道会被关闭，从断开的位置重新订阅
+		for event := range ch {
+			lastEventId = event.Id
+			handleResourceEvent(s, event)
+		}
+		debugLog("⚠️  [Resources] 事件订阅已断开，重新订阅 | Last-Event-ID: %d", lastEventId)
+	}
+}
+
+func handleResourceEvent(s *server.MCPServer, event Event) {
+	switch event.Type {
+	case EventTaskStatusChanged, EventResponseAdded:
+		sendResourcesListChanged(s)
+	}
+}
+
+func sendResourcesListChanged(s *server.MCPServer) {
+	s.SendNotificationToAllClients(mcp.MethodNotificationResourcesListChanged, nil)
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store 持久化存储后端
+// TaskManager 和 SessionManager 的所有变更都会写穿到 Store，启动时通过 Load 恢复状态
+type Store interface {
+	Load() (*StoreSnapshot, error)
+	SaveTask(task TaskStatus) error
+	DeleteTask(taskId string) error
+	ClearTasks() error
+	ReorderTasks(taskIds []string) error
+	AppendResponse(resp UserChoiceResponse) error
+	SaveRenderTasks(tasks []RenderTask) error
+	SaveTemplates(state TemplateLibraryState) error
+	SaveTicket(ticket TicketRecord) error
+	DeleteTicket(ticketId string) error
+	Close() error
+}
+
+// StoreSnapshot Store 中恢复出来的完整状态
+type StoreSnapshot struct {
+	Tasks       []*TaskStatus         `json:"tasks"`
+	Responses   []UserChoiceResponse  `json:"responses"`
+	RenderTasks []RenderTask          `json:"renderTasks"`
+	Templates   *TemplateLibraryState `json:"templates,omitempty"`
+	AliasSeq    int                   `json:"aliasSeq,omitempty"` // 用过的最大别名编号，包括已删除或清空的任务
+	Tickets     []TicketRecord        `json:"tickets,omitempty"`  // 已遗弃或已过期的异步提问
+}
+
+// memoryStore 不做任何持久化，用于关闭存储的场景
+type memoryStore struct{}
+
+func (memoryStore) Load() (*StoreSnapshot, error)            { return &StoreSnapshot{}, nil }
+func (memoryStore) SaveTask(TaskStatus) error                { return nil }
+func (memoryStore) DeleteTask(string) error                  { return nil }
+func (memoryStore) ClearTasks() error                        { return nil }
+func (memoryStore) ReorderTasks([]string) error              { return nil }
+func (memoryStore) AppendResponse(UserChoiceResponse) error  { return nil }
+func (memoryStore) SaveRenderTasks([]RenderTask) error       { return nil }
+func (memoryStore) SaveTemplates(TemplateLibraryState) error { return nil }
+func (memoryStore) SaveTicket(TicketRecord) error            { return nil }
+func (memoryStore) DeleteTicket(string) error                { return nil }
+func (memoryStore) Close() error                             { return nil }
+
+// 存储记录的操作类型
+const (
+	opTaskPut      = "task_put"
+	opTaskDelete   = "task_delete"
+	opTaskClear    = "task_clear"
+	opTaskReorder  = "task_reorder"
+	opResponseAdd  = "response_add"
+	opRenderTasks  = "render_tasks"
+	opTemplates    = "templates"
+	opAliasSeq     = "alias_seq" // 压缩时记录用过的最大别名编号，避免清空任务后别名被复用
+	opTicketPut    = "ticket_put"
+	opTicketDelete = "ticket_delete"
+)
+
+// storeRecord JSON-lines 文件中的一行
+type storeRecord struct {
+	Op          string                `json:"op"`
+	Task        *TaskStatus           `json:"task,omitempty"`
+	TaskId      string                `json:"taskId,omitempty"`
+	TaskIds     []string              `json:"taskIds,omitempty"`
+	Response    *UserChoiceResponse   `json:"response,omitempty"`
+	RenderTasks []RenderTask          `json:"renderTasks,omitempty"`
+	Templates   *TemplateLibraryState `json:"templates,omitempty"`
+	AliasSeq    int                   `json:"aliasSeq,omitempty"`
+	Ticket      *TicketRecord         `json:"ticket,omitempty"`
+	TicketId    string                `json:"ticketId,omitempty"`
+}
+
+// FileStore 基于 JSON-lines 追加日志的文件存储
+// 每次变更追加一行记录，Load 时回放所有记录并压缩重写文件
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load 回放日志恢复状态，然后把压缩后的快照重写回文件
+func (fs *FileStore) Load() (*StoreSnapshot, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	snapshot, err := fs.replay()
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.compact(snapshot); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(fs.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开存储文件失败: %v", err)
+	}
+	fs.file = file
+	debugLog("💾 [Store] 状态已恢复 | 文件: %s | 任务: %d | 响应: %d | 渲染任务: %d",
+		fs.path, len(snapshot.Tasks), len(snapshot.Responses), len(snapshot.RenderTasks))
+	return snapshot, nil
+}
+
+// replay 逐行回放日志
+func (fs *FileStore) replay() (*StoreSnapshot, error) {
+	snapshot := &StoreSnapshot{}
+
+	file, err := os.Open(fs.path)
+	if os.IsNotExist(err) {
+		return snapshot, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取存储文件失败: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec storeRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// 最后一行可能因为进程被杀而写了一半，跳过损坏的记录
+			debugLog("⚠️  [Store] 跳过损坏的记录 | 行: %d | %v", line, err)
+			continue
+		}
+		snapshot.apply(rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取存储文件失败: %v", err)
+	}
+	return snapshot, nil
+}
+
+// apply 把一条记录应用到快照上
+func (s *StoreSnapshot) apply(rec storeRecord) {
+	switch rec.Op {
+	case opTaskPut:
+		if rec.Task == nil {
+			return
+		}
+		s.AliasSeq = max(s.AliasSeq, aliasSeq(rec.Task.Alias))
+		for i, task := range s.Tasks {
+			if task.TaskId == rec.Task.TaskId {
+				s.Tasks[i] = rec.Task
+				return
+			}
+		}
+		s.Tasks = append(s.Tasks, rec.Task)
+	case opTaskDelete:
+		for i, task := range s.Tasks {
+			if task.TaskId == rec.TaskId {
+				s.Tasks = append(s.Tasks[:i], s.Tasks[i+1:]...)
+				return
+			}
+		}
+	case opTaskClear:
+		s.Tasks = nil
+	case opTaskReorder:
+		// 记录之后被删除的任务不参与排序
+		known := make(map[string]bool, len(s.Tasks))
+		for _, task := range s.Tasks {
+			known[task.TaskId] = true
+		}
+		ids := make([]string, 0, len(rec.TaskIds))
+		for _, id := range rec.TaskIds {
+			if known[id] {
+				ids = append(ids, id)
+				delete(known, id)
+			}
+		}
+		reorderTasks(s.Tasks, ids)
+	case opResponseAdd:
+		if rec.Response != nil {
+			s.Responses = append(s.Responses, *rec.Response)
+		}
+	case opRenderTasks:
+		s.RenderTasks = rec.RenderTasks
+	case opTemplates:
+		s.Templates = rec.Templates
+	case opAliasSeq:
+		s.AliasSeq = max(s.AliasSeq, rec.AliasSeq)
+	case opTicketPut:
+		if rec.Ticket == nil {
+			return
+		}
+		for i, ticket := range s.Tickets {
+			if ticket.Id == rec.Ticket.Id {
+				s.Tickets[i] = *rec.Ticket
+				return
+			}
+		}
+		s.Tickets = append(s.Tickets, *rec.Ticket)
+	case opTicketDelete:
+		for i, ticket := range s.Tickets {
+			if ticket.Id == rec.TicketId {
+				s.Tickets = append(s.Tickets[:i], s.Tickets[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// compact 把快照写入临时文件后原子替换原文件
+func (fs *FileStore) compact(snapshot *StoreSnapshot) error {
+	if dir := filepath.Dir(fs.path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("创建存储目录失败: %v", err)
+		}
+	}
+
+	tmpPath := fs.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("创建临时存储文件失败: %v", err)
+	}
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	if snapshot.AliasSeq > 0 {
+		enc.Encode(storeRecord{Op: opAliasSeq, AliasSeq: snapshot.AliasSeq})
+	}
+	for _, task := range snapshot.Tasks {
+		enc.Encode(storeRecord{Op: opTaskPut, Task: task})
+	}
+	for i := range snapshot.Responses {
+		enc.Encode(storeRecord{Op: opResponseAdd, Response: &snapshot.Responses[i]})
+	}
+	if len(snapshot.RenderTasks) > 0 {
+		enc.Encode(storeRecord{Op: opRenderTasks, RenderTasks: snapshot.RenderTasks})
+	}
+	if snapshot.Templates != nil {
+		enc.Encode(storeRecord{Op: opTemplates, Templates: snapshot.Templates})
+	}
+	for i := range snapshot.Tickets {
+		enc.Encode(storeRecord{Op: opTicketPut, Ticket: &snapshot.Tickets[i]})
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入临时存储文件失败: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入临时存储文件失败: %v", err)
+	}
+	if err := os.Rename(tmpPath, fs.path); err != nil {
+		return fmt.Errorf("替换存储文件失败: %v", err)
+	}
+	return nil
+}
+
+// append 追加一条记录
+func (fs *FileStore) append(rec storeRecord) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.file == nil {
+		return fmt.Errorf("存储文件未打开")
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = fs.file.Write(append(data, '\n'))
+	return err
+}
+
+func (fs *FileStore) SaveTask(task TaskStatus) error {
+	return fs.append(storeRecord{Op: opTaskPut, Task: &task})
+}
+
+func (fs *FileStore) DeleteTask(taskId string) error {
+	return fs.append(storeRecord{Op: opTaskDelete, TaskId: taskId})
+}
+
+func (fs *FileStore) ClearTasks() error {
+	return fs.append(storeRecord{Op: opTaskClear})
+}
+
+func (fs *FileStore) ReorderTasks(taskIds []string) error {
+	return fs.append(storeRecord{Op: opTaskReorder, TaskIds: taskIds})
+}
+
+func (fs *FileStore) AppendResponse(resp UserChoiceResponse) error {
+	return fs.append(storeRecord{Op: opResponseAdd, Response: &resp})
+}
+
+func (fs *FileStore) SaveRenderTasks(tasks []RenderTask) error {
+	return fs.append(storeRecord{Op: opRenderTasks, RenderTasks: tasks})
+}
+
+func (fs *FileStore) SaveTemplates(state TemplateLibraryState) error {
+	return fs.append(storeRecord{Op: opTemplates, Templates: &state})
+}
+
+func (fs *FileStore) SaveTicket(ticket TicketRecord) error {
+	return fs.append(storeRecord{Op: opTicketPut, Ticket: &ticket})
+}
+
+func (fs *FileStore) DeleteTicket(ticketId string) error {
+	return fs.append(storeRecord{Op: opTicketDelete, TicketId: ticketId})
+}
+
+func (fs *FileStore) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.file == nil {
+		return nil
+	}
+	err := fs.file.Close()
+	fs.file = nil
+	return err
+}
+
+// NewStore 根据配置的存储路径创建存储，值为 memory 时不做持久化
+func NewStore(path string) Store {
+	if path == "memory" {
+		return memoryStore{}
+	}
+	return NewFileStore(path)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// restart 模拟一次服务重启：关闭当前存储，重建全局状态后从 path 恢复
+// 测试结束时关闭存储并还原全局状态
+func restart(t *testing.T, path string) *SessionManager {
+	t.Helper()
+	prevManager, prevIdGen, prevTickets, prevTemplates := globalSessionManager, insIdGen, globalTickets, globalTemplates
+	t.Cleanup(func() {
+		globalSessionManager.store.Close()
+		globalSessionManager, insIdGen, globalTickets, globalTemplates = prevManager, prevIdGen, prevTickets, prevTemplates
+	})
+
+	globalSessionManager.store.Close()
+	insIdGen = NewIdGenerator(0)
+	globalTickets = NewTicketManager()
+	globalTemplates = NewTemplateLibrary()
+	globalSessionManager = NewSessionManager(10)
+	if err := globalSessionManager.Restore(NewFileStore(path)); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	return globalSessionManager
+}
+
+// readRecords 读取存储文件中的所有记录
+func readRecords(t *testing.T, path string) []storeRecord {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer file.Close()
+
+	var records []storeRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec storeRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestFileStoreReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+	store := NewFileStore(path)
+	if _, err := store.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.SaveTask(TaskStatus{TaskId: "a", Alias: "T-1", Status: "pending", Req: "first"})
+	store.SaveTask(TaskStatus{TaskId: "b", Alias: "T-2", Status: "pending", Req: "second"})
+	store.SaveTask(TaskStatus{TaskId: "c", Alias: "T-3", Status: "pending", Req: "third"})
+	store.SaveTask(TaskStatus{TaskId: "a", Alias: "T-1", Status: "completed", Req: "first", Resp: "done"})
+	store.DeleteTask("b")
+	store.ReorderTasks([]string{"c", "b", "a"})
+	store.AppendResponse(UserChoiceResponse{TaskId: "a", CustomInput: "first"})
+	store.SaveRenderTasks([]RenderTask{{Id: "r1", Summary: "old"}})
+	store.SaveRenderTasks([]RenderTask{{Id: "r2", Summary: "new"}})
+	store.Close()
+
+	// 最后一行写了一半（进程被杀），回放时跳过
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	file.WriteString(`{"op":"task_put","task":{"taskId":"d"`)
+	file.Close()
+
+	store = NewFileStore(path)
+	snapshot, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	defer store.Close()
+
+	if len(snapshot.Tasks) != 2 {
+		t.Fatalf("tasks = %d, want 2", len(snapshot.Tasks))
+	}
+	if snapshot.Tasks[0].TaskId != "c" || snapshot.Tasks[1].TaskId != "a" {
+		t.Errorf("task order = %s, %s, want c, a", snapshot.Tasks[0].TaskId, snapshot.Tasks[1].TaskId)
+	}
+	if got := snapshot.Tasks[1]; got.Status != "completed" || got.Resp != "done" {
+		t.Errorf("task a = %s/%q, want the last put (completed/done)", got.Status, got.Resp)
+	}
+	if len(snapshot.Responses) != 1 || snapshot.Responses[0].TaskId != "a" {
+		t.Errorf("responses = %+v, want one response for a", snapshot.Responses)
+	}
+	if len(snapshot.RenderTasks) != 1 || snapshot.RenderTasks[0].Id != "r2" {
+		t.Errorf("render tasks = %+v, want only the last saved list", snapshot.RenderTasks)
+	}
+	if snapshot.AliasSeq != 3 {
+		t.Errorf("alias seq = %d, want 3", snapshot.AliasSeq)
+	}
+}
+
+func TestFileStoreCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+	store := NewFileStore(path)
+	store.Load()
+	for i := 0; i < 5; i++ {
+		store.SaveTask(TaskStatus{TaskId: "a", Alias: "T-1", Status: "pending"})
+	}
+	store.SaveTask(TaskStatus{TaskId: "b", Alias: "T-2", Status: "pending"})
+	store.DeleteTask("b")
+	store.AppendResponse(UserChoiceResponse{TaskId: "a"})
+	store.Close()
+
+	store = NewFileStore(path)
+	first, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Close()
+
+	// 压缩后每个任务只剩一条记录，已删除的任务不再出现，别名编号单独记录
+	ops := make(map[string]int)
+	for _, rec := range readRecords(t, path) {
+		ops[rec.Op]++
+	}
+	want := map[string]int{opAliasSeq: 1, opTaskPut: 1, opResponseAdd: 1}
+	if len(ops) != len(want) {
+		t.Errorf("compacted ops = %v, want %v", ops, want)
+	}
+	for op, n := range want {
+		if ops[op] != n {
+			t.Errorf("compacted %s records = %d, want %d", op, ops[op], n)
+		}
+	}
+
+	// 再次回放压缩后的文件得到相同的状态
+	store = NewFileStore(path)
+	second, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Close()
+	a, _ := json.Marshal(first)
+	b, _ := json.Marshal(second)
+	if string(a) != string(b) {
+		t.Errorf("snapshot changed after compaction:\n%s\n%s", a, b)
+	}
+}
+
+func TestRestoreRequeuesPendingResponses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+	sm := restart(t, path)
+	first, _ := sm.PushResponse(UserChoiceResponse{CustomInput: "first", Continue: true, SelectedIndex: -1})
+	second, _ := sm.PushResponse(UserChoiceResponse{CustomInput: "second", Continue: true, SelectedIndex: -1})
+	// 已被领取的指令重启后不再入队
+	if resp, ok := sm.Out.Pop(); !ok || resp.TaskId != first {
+		t.Fatalf("Pop = %s, want %s", resp.TaskId, first)
+	}
+	sm.Taskmng.ClaimTask(first, "", "first", "")
+
+	sm = restart(t, path)
+	if n := sm.Out.Len(); n != 1 {
+		t.Fatalf("queued after restart = %d, want 1", n)
+	}
+	if resp, _ := sm.Out.Pop(); resp.TaskId != second {
+		t.Errorf("requeued %s, want %s", resp.TaskId, second)
+	}
+	if task, ok := sm.Taskmng.SnapshotTask(first); !ok || task.Status != "processing" {
+		t.Errorf("claimed task after restart = %+v, want processing", task)
+	}
+}
+
+func TestAliasContinuityAfterClearAndRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+	aliasOf := func(sm *SessionManager, taskId string) string {
+		t.Helper()
+		task, ok := sm.Taskmng.SnapshotTask(taskId)
+		if !ok {
+			t.Fatalf("task %s not found", taskId)
+		}
+		return task.Alias
+	}
+
+	sm := restart(t, path)
+	sm.PushResponse(UserChoiceResponse{CustomInput: "first", Continue: true, SelectedIndex: -1})
+	sm.PushResponse(UserChoiceResponse{CustomInput: "second", Continue: true, SelectedIndex: -1})
+	sm.ClearAllTasks()
+
+	// 清空后重启，别名从用过的最大编号之后继续，AI 带回的旧别名不会命中新任务
+	sm = restart(t, path)
+	id, _ := sm.PushResponse(UserChoiceResponse{CustomInput: "third", Continue: true, SelectedIndex: -1})
+	if alias := aliasOf(sm, id); alias != "T-3" {
+		t.Errorf("alias after clear and restart = %s, want T-3", alias)
+	}
+	if _, ok := sm.Taskmng.SnapshotTask("T-1"); ok {
+		t.Errorf("cleared alias T-1 still resolves")
+	}
+
+	// 再清空一次并连续重启两次（第二次重启时存储中已经没有任何任务）
+	sm.ClearAllTasks()
+	restart(t, path)
+	sm = restart(t, path)
+	id, _ = sm.PushResponse(UserChoiceResponse{CustomInput: "fourth", Continue: true, SelectedIndex: -1})
+	if alias := aliasOf(sm, id); alias != "T-4" {
+		t.Errorf("alias after two restarts = %s, want T-4", alias)
+	}
+}
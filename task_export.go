@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 支持导出的文件格式
+const (
+	exportJSON     = "json"     // 与页面原来导出的格式相同，可以直接通过 /api/tasks/import 导回
+	exportJSONL    = "jsonl"    // 每行一个任务
+	exportCSV      = "csv"      // 第一行为表头
+	exportMarkdown = "markdown" // 按任务列出请求和结果的报告，便于归档到 docs/
+)
+
+// exportFilter /api/tasks/export 的筛选条件，零值表示不筛选
+type exportFilter struct {
+	Statuses  map[string]bool // 任务状态，多个用逗号分隔
+	From      time.Time       // 创建时间不早于
+	To        time.Time       // 创建时间早于
+	SessionId string          // 指定投递或领取任务的会话
+	Query     string          // 在请求和结果中搜索，不区分大小写
+}
+
+// parseExportTime 解析 RFC3339 时间或 2006-01-02 日期（本地时区），日期作为结束时间时包含当天
+func parseExportTime(value string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, use YYYY-MM-DD or RFC3339", value)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func parseExportFilter(r *http.Request) (exportFilter, error) {
+	query := r.URL.Query()
+	filter := exportFilter{
+		SessionId: query.Get("session"),
+		Query:     strings.ToLower(strings.TrimSpace(query.Get("q"))),
+	}
+	if v := query.Get("status"); v != "" {
+		filter.Statuses = make(map[string]bool)
+		for _, status := range strings.Split(v, ",") {
+			switch status = strings.TrimSpace(status); status {
+			case "pending", "processing", "completed":
+				filter.Statuses[status] = true
+			default:
+				return filter, fmt.Errorf("invalid status %q, use pending, processing or completed", status)
+			}
+		}
+	}
+	var err error
+	if v := query.Get("from"); v != "" {
+		if filter.From, err = parseExportTime(v, false); err != nil {
+			return filter, err
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		if filter.To, err = parseExportTime(v, true); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
+
+// match 任务是否满足筛选条件，按时间筛选时没有创建时间的旧任务不会导出
+func (f exportFilter) match(task TaskStatus) bool {
+	if f.Statuses != nil && !f.Statuses[task.Status] {
+		return false
+	}
+	if !f.From.IsZero() && (task.CreatedAt.IsZero() || task.CreatedAt.Before(f.From)) {
+		return false
+	}
+	if !f.To.IsZero() && (task.CreatedAt.IsZero() || !task.CreatedAt.Before(f.To)) {
+		return false
+	}
+	if f.SessionId != "" && task.SessionId != f.SessionId {
+		return false
+	}
+	if f.Query != "" && !strings.Contains(strings.ToLower(task.Req), f.Query) && !strings.Contains(strings.ToLower(task.Resp), f.Query) {
+		return false
+	}
+	return true
+}
+
+// handleExportTasks 处理 GET /api/tasks/export，按筛选条件导出任务
+// 查询参数：format 导出格式（默认 json），status 状态（逗号分隔），from / to 创建时间范围，session 会话ID，q 搜索文本
+func handleExportTasks(w http.ResponseWriter, r *http.Request) {
+	debugLog("🌐 [HTTP] %s %s | 导出任务", r.Method, r.URL.Path)
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	switch format {
+	case "":
+		format = exportJSON
+	case "md":
+		format = exportMarkdown
+	case "ndjson":
+		format = exportJSONL
+	case exportJSON, exportJSONL, exportCSV, exportMarkdown:
+	default:
+		http.Error(w, "unsupported format: "+format, http.StatusBadRequest)
+		return
+	}
+	filter, err := parseExportFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 先复制一份快照，写出时不持有任务管理器的锁
+	tasks := make([]TaskStatus, 0)
+	for _, task := range globalSessionManager.Taskmng.SnapshotTasks() {
+		if filter.match(task) {
+			tasks = append(tasks, task)
+		}
+	}
+	debugLog("📤 [HTTP] 导出任务 | 格式: %s | 数量: %d", format, len(tasks))
+
+	now := time.Now()
+	ext := map[string]string{exportJSON: "json", exportJSONL: "jsonl", exportCSV: "csv", exportMarkdown: "md"}[format]
+	contentType := map[string]string{
+		exportJSON:     "application/json",
+		exportJSONL:    "application/x-ndjson",
+		exportCSV:      "text/csv",
+		exportMarkdown: "text/markdown",
+	}[format]
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="tasks_%s.%s"`, now.Format(time.DateOnly), ext))
+
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+	switch format {
+	case exportJSON:
+		writeExportJSON(out, tasks, now)
+	case exportJSONL:
+		enc := json.NewEncoder(out)
+		for _, task := range tasks {
+			enc.Encode(task)
+		}
+	case exportCSV:
+		writeExportCSV(out, tasks)
+	case exportMarkdown:
+		writeExportMarkdown(out, requestLocale(r), tasks, filter, now)
+	}
+}
+
+// writeExportJSON 逐个写出任务，外层结构与页面原来导出的文件相同
+func writeExportJSON(out *bufio.Writer, tasks []TaskStatus, now time.Time) {
+	fmt.Fprintf(out, "{\n  \"exportTime\": %q,\n  \"exportDate\": %q,\n  \"totalTasks\": %d,\n  \"tasks\": [",
+		now.UTC().Format(time.RFC3339Nano), now.Format(time.DateTime), len(tasks))
+	for i, task := range tasks {
+		data, _ := json.MarshalIndent(task, "    ", "  ")
+		if i > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n    ")
+		out.Write(data)
+	}
+	if len(tasks) > 0 {
+		out.WriteString("\n  ")
+	}
+	out.WriteString("]\n}\n")
+}
+
+// exportTime CSV 和报告中的时间，旧任务没有时间时为空
+func exportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// writeExportCSV 表头包含 req、priority、pinned 列，可以直接通过 /api/tasks/import 导回
+func writeExportCSV(out *bufio.Writer, tasks []TaskStatus) {
+	out.WriteString("\xef\xbb\xbf") // BOM，Excel 打开时按 UTF-8 识别中文
+	cw := csv.NewWriter(out)
+	cw.Write([]string{"taskId", "status", "req", "resp", "channel", "sessionId", "priority", "pinned", "createdAt", "updatedAt", "completedAt"})
+	for _, task := range tasks {
+		cw.Write([]string{
+			task.TaskId,
+			task.Status,
+			task.Req,
+			task.Resp,
+			task.Channel,
+			task.SessionId,
+			strconv.Itoa(task.Priority),
+			strconv.FormatBool(task.Pinned),
+			exportTime(task.CreatedAt),
+			exportTime(task.UpdatedAt),
+			exportTime(task.CompletedAt),
+		})
+	}
+	cw.Flush()
+}
+
+// 报告中各状态的标记
+var exportStatusIcons = map[string]string{
+	"pending":    "⏳",
+	"processing": "🔄",
+	"completed":  "✅",
+}
+
+// writeExportMarkdown 写出任务报告：筛选条件、按状态的统计，以及每个任务的请求和结果，文案使用指定语言
+func writeExportMarkdown(out *bufio.Writer, locale string, tasks []TaskStatus, filter exportFilter, now time.Time) {
+	text := func(key string, args ...string) string { return globalI18n.Text(locale, "report."+key, args...) }
+	counts := make(map[string]int)
+	for _, task := range tasks {
+		counts[task.Status]++
+	}
+
+	fmt.Fprintf(out, "# %s\n\n", text("title"))
+	fmt.Fprintf(out, "- %s\n", text("exportedAt", "time", now.Format(time.DateTime)))
+	if conditions := filter.describe(locale); conditions != "" {
+		fmt.Fprintf(out, "- %s\n", text("filter", "conditions", conditions))
+	}
+	fmt.Fprintf(out, "- %s\n", text("count",
+		"total", strconv.Itoa(len(tasks)),
+		"completed", strconv.Itoa(counts["completed"]),
+		"processing", strconv.Itoa(counts["processing"]),
+		"pending", strconv.Itoa(counts["pending"])))
+
+	for i, task := range tasks {
+		title, _, _ := strings.Cut(strings.TrimSpace(task.Req), "\n")
+		if runes := []rune(title); len(runes) > 60 {
+			title = string(runes[:60]) + "…"
+		}
+		fmt.Fprintf(out, "\n## %d. %s %s\n\n", i+1, exportStatusIcons[task.Status], title)
+
+		meta := []string{"ID: `" + task.TaskId + "`", text("status", "value", task.Status)}
+		if task.Channel != "" {
+			meta = append(meta, text("channel", "value", task.Channel))
+		}
+		if task.SessionId != "" {
+			meta = append(meta, text("session", "value", "`"+task.SessionId+"`"))
+		}
+		if task.Priority != 0 || task.Pinned {
+			meta = append(meta, text("priority", "value", strconv.Itoa(task.Priority)))
+		}
+		if !task.CreatedAt.IsZero() {
+			meta = append(meta, text("created", "value", task.CreatedAt.Format(time.DateTime)))
+		}
+		if !task.CompletedAt.IsZero() {
+			meta = append(meta, text("completed", "value", task.CompletedAt.Format(time.DateTime)))
+		}
+		fmt.Fprintf(out, "%s\n\n", strings.Join(meta, " | "))
+
+		fmt.Fprintf(out, "**%s**\n\n%s\n\n", text("request"), markdownBlock(task.Req))
+		resp := task.Resp
+		if resp == "" {
+			resp = text("none")
+		}
+		fmt.Fprintf(out, "**%s**\n\n%s\n", text("result"), markdownBlock(resp))
+	}
+}
+
+// markdownBlock 把多行文本写成引用块，避免其中的标题、列表等打乱报告结构
+func markdownBlock(text string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// describe 报告中显示的筛选条件，文案使用指定语言
+func (f exportFilter) describe(locale string) string {
+	text := func(key, value string) string { return globalI18n.Text(locale, "report."+key, "value", value) }
+	parts := make([]string, 0)
+	if f.Statuses != nil {
+		statuses := make([]string, 0, len(f.Statuses))
+		for _, status := range []string{"pending", "processing", "completed"} {
+			if f.Statuses[status] {
+				statuses = append(statuses, status)
+			}
+		}
+		parts = append(parts, text("filterStatus", strings.Join(statuses, ",")))
+	}
+	if !f.From.IsZero() {
+		parts = append(parts, text("filterFrom", f.From.Format(time.DateTime)))
+	}
+	if !f.To.IsZero() {
+		parts = append(parts, text("filterTo", f.To.Format(time.DateTime)))
+	}
+	if f.SessionId != "" {
+		parts = append(parts, text("filterSession", "`"+f.SessionId+"`"))
+	}
+	if f.Query != "" {
+		parts = append(parts, text("filterQuery", f.Query))
+	}
+	return strings.Join(parts, " | ")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 导出再导入时需要保留的内容：多行、逗号、引号和中文
+var roundTripTasks = []UserChoiceResponse{
+	{CustomInput: "plain task", Continue: true, SelectedIndex: -1},
+	{CustomInput: "first line\nsecond line, with \"quotes\"", Continue: true, SelectedIndex: -1, Priority: 3},
+	{CustomInput: "置顶的任务", Continue: true, SelectedIndex: -1, Pinned: true, Priority: -2},
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []string{exportJSON, exportJSONL, exportCSV} {
+		t.Run(format, func(t *testing.T) {
+			sm := restart(t, filepath.Join(t.TempDir(), "source.jsonl"))
+			if _, err := sm.PushResponses(roundTripTasks); err != nil {
+				t.Fatalf("PushResponses: %v", err)
+			}
+			rec := httptest.NewRecorder()
+			handleExportTasks(rec, httptest.NewRequest(http.MethodGet, "/api/tasks/export?format="+format, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("export status = %d: %s", rec.Code, rec.Body)
+			}
+			exported := rec.Body.String()
+
+			// 导入到另一个实例，格式根据 Content-Type 判断
+			sm = restart(t, filepath.Join(t.TempDir(), "target.jsonl"))
+			req := httptest.NewRequest(http.MethodPost, "/api/tasks/import", strings.NewReader(exported))
+			req.Header.Set("Content-Type", rec.Header().Get("Content-Type"))
+			rec = httptest.NewRecorder()
+			handleImportTasks(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("import status = %d: %s", rec.Code, rec.Body)
+			}
+			var report importReport
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Fatalf("invalid report: %v", err)
+			}
+			if report.Format != format || report.Imported != len(roundTripTasks) {
+				t.Fatalf("report = %s/%d imported, want %s/%d", report.Format, report.Imported, format, len(roundTripTasks))
+			}
+
+			tasks := sm.Taskmng.SnapshotTasks()
+			if len(tasks) != len(roundTripTasks) {
+				t.Fatalf("tasks = %d, want %d", len(tasks), len(roundTripTasks))
+			}
+			for i, want := range roundTripTasks {
+				got := tasks[i]
+				if got.Req != want.CustomInput || got.Priority != want.Priority || got.Pinned != want.Pinned {
+					t.Errorf("task %d = %q/%d/%t, want %q/%d/%t", i, got.Req, got.Priority, got.Pinned, want.CustomInput, want.Priority, want.Pinned)
+				}
+				if got.Channel != channelImport || got.Status != "pending" {
+					t.Errorf("task %d = %s/%s, want an imported pending task", i, got.Channel, got.Status)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 支持导入的文件格式
+const (
+	importJSON     = "json"     // 页面导出的格式：{"exportTime": ..., "totalTasks": ..., "tasks": [{"req": ...}]}，也可以直接是 tasks 数组
+	importJSONL    = "jsonl"    // 每行一个 {"req": ...} 对象
+	importCSV      = "csv"      // 第一行为表头，必须包含 req 列
+	importMarkdown = "markdown" // 清单：- [ ] 任务，已勾选的 - [x] 视为已完成，跳过
+)
+
+// 导入文件大小上限
+const maxImportBytes = 8 << 20
+
+// 导入条目的状态
+const (
+	importReady    = "ready"    // 校验通过（预览时）
+	importImported = "imported" // 已导入
+	importSkipped  = "skipped"  // 跳过，例如清单中已勾选的任务
+	importInvalid  = "invalid"  // 校验失败，整个导入不会执行
+)
+
+// importItem 导入文件中的一条任务及其处理结果
+type importItem struct {
+	Index    int    `json:"index"`          // 在文件中的序号，从0开始
+	Line     int    `json:"line,omitempty"` // 所在行号，JSON 格式不返回
+	Req      string `json:"req"`
+	Priority int    `json:"priority"`
+	Pinned   bool   `json:"pinned,omitempty"`
+	Continue bool   `json:"continue"`
+	Status   string `json:"status"` // ready | imported | skipped | invalid
+	Error    string `json:"error,omitempty"`
+	TaskId   string `json:"taskId,omitempty"`
+}
+
+// importRow JSON / JSONL 格式中的一条任务，导出文件中的其他字段（taskId、status、resp 等）忽略
+type importRow struct {
+	Req      string `json:"req"`
+	Priority int    `json:"priority"`
+	Pinned   bool   `json:"pinned"`
+	Continue *bool  `json:"continue"` // 不传时为 true
+}
+
+// importReport /api/tasks/import 的返回结果
+type importReport struct {
+	Format   string       `json:"format"`
+	DryRun   bool         `json:"dryRun"`
+	Valid    bool         `json:"valid"` // 所有条目都通过校验
+	Total    int          `json:"total"`
+	Imported int          `json:"imported"`
+	Skipped  int          `json:"skipped"`
+	Invalid  int          `json:"invalid"`
+	Error    string       `json:"error,omitempty"`
+	Items    []importItem `json:"items"`
+}
+
+// newImportItem 校验并创建一条导入条目
+func newImportItem(index, line int, row importRow) importItem {
+	item := importItem{
+		Index:    index,
+		Line:     line,
+		Req:      strings.TrimSpace(row.Req),
+		Priority: row.Priority,
+		Pinned:   row.Pinned,
+		Continue: row.Continue == nil || *row.Continue,
+		Status:   importReady,
+	}
+	if item.Req == "" {
+		item.Status = importInvalid
+		item.Error = "req is required"
+	}
+	return item
+}
+
+func invalidImportItem(index, line int, err error) importItem {
+	return importItem{Index: index, Line: line, Continue: true, Status: importInvalid, Error: err.Error()}
+}
+
+// detectImportFormat 依次根据 format 参数、文件扩展名、Content-Type 和内容判断格式
+func detectImportFormat(format, filename, contentType string, body []byte) (string, error) {
+	switch strings.ToLower(format) {
+	case importJSON, importJSONL, importCSV, importMarkdown:
+		return strings.ToLower(format), nil
+	case "md":
+		return importMarkdown, nil
+	case "ndjson":
+		return importJSONL, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unsupported format: %s", format)
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return importJSON, nil
+	case ".jsonl", ".ndjson":
+		return importJSONL, nil
+	case ".csv":
+		return importCSV, nil
+	case ".md", ".markdown":
+		return importMarkdown, nil
+	}
+
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch strings.TrimSpace(strings.ToLower(mediaType)) {
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return importJSONL, nil
+	case "text/csv":
+		return importCSV, nil
+	case "text/markdown":
+		return importMarkdown, nil
+	}
+
+	// 根据内容判断：完整的 JSON 文档按 json 处理，否则以 { 开头的按 jsonl 处理
+	trimmed := bytes.TrimSpace(body)
+	switch {
+	case len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed):
+		return importJSON, nil
+	case len(trimmed) > 0 && trimmed[0] == '{':
+		return importJSONL, nil
+	case checklistPattern.Match(trimmed):
+		return importMarkdown, nil
+	}
+	return "", errors.New("cannot detect format, pass ?format=json|jsonl|csv|markdown")
+}
+
+// parseImport 把文件内容解析为导入条目，单条任务的问题记录在条目上，整个文件无法解析时返回错误
+func parseImport(format string, body []byte) ([]importItem, error) {
+	body = bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")) // 去掉 Excel 等工具写入的 BOM
+	switch format {
+	case importJSON:
+		return parseImportJSON(body)
+	case importJSONL:
+		return parseImportJSONL(body)
+	case importCSV:
+		return parseImportCSV(body)
+	case importMarkdown:
+		return parseImportMarkdown(body), nil
+	}
+	return nil, fmt.Errorf("unsupported format: %s", format)
+}
+
+func parseImportJSON(body []byte) ([]importItem, error) {
+	var rows []json.RawMessage
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &rows); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+	} else {
+		var doc struct {
+			Tasks []json.RawMessage `json:"tasks"`
+		}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+		if doc.Tasks == nil {
+			return nil, errors.New(`invalid JSON: missing "tasks" array`)
+		}
+		rows = doc.Tasks
+	}
+
+	items := make([]importItem, 0, len(rows))
+	for i, raw := range rows {
+		var row importRow
+		if err := json.Unmarshal(raw, &row); err != nil {
+			items = append(items, invalidImportItem(i, 0, err))
+			continue
+		}
+		items = append(items, newImportItem(i, 0, row))
+	}
+	return items, nil
+}
+
+func parseImportJSONL(body []byte) ([]importItem, error) {
+	items := make([]importItem, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportBytes)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var row importRow
+		if err := json.Unmarshal(text, &row); err != nil {
+			items = append(items, invalidImportItem(len(items), line, err))
+			continue
+		}
+		items = append(items, newImportItem(len(items), line, row))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid JSONL: %v", err)
+	}
+	return items, nil
+}
+
+func parseImportCSV(body []byte) ([]importItem, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("invalid CSV: empty file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["req"]; !ok {
+		return nil, errors.New(`invalid CSV: header must contain a "req" column`)
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	items := make([]importItem, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		index := len(items)
+
+		row := importRow{Req: field(record, "req")}
+		if v := field(record, "priority"); v != "" {
+			if row.Priority, err = strconv.Atoi(v); err != nil {
+				items = append(items, invalidImportItem(index, line, fmt.Errorf("invalid priority: %s", v)))
+				continue
+			}
+		}
+		if v := field(record, "pinned"); v != "" {
+			if row.Pinned, err = strconv.ParseBool(v); err != nil {
+				items = append(items, invalidImportItem(index, line, fmt.Errorf("invalid pinned: %s", v)))
+				continue
+			}
+		}
+		if v := field(record, "continue"); v != "" {
+			cont, err := strconv.ParseBool(v)
+			if err != nil {
+				items = append(items, invalidImportItem(index, line, fmt.Errorf("invalid continue: %s", v)))
+				continue
+			}
+			row.Continue = &cont
+		}
+		items = append(items, newImportItem(index, line, row))
+	}
+	return items, nil
+}
+
+// checklistPattern Markdown 清单项：- [ ] 任务、* [x] 任务、1. [ ] 任务
+var checklistPattern = regexp.MustCompile(`(?m)^\s*(?:[-*+]|\d+[.)])\s+\[([ xX])\]\s+(.*?)\s*$`)
+
+// parseImportMarkdown 只取清单项，其他行（标题、说明文字等）忽略
+func parseImportMarkdown(body []byte) []importItem {
+	items := make([]importItem, 0)
+	for i, text := range strings.Split(string(body), "\n") {
+		m := checklistPattern.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		item := newImportItem(len(items), i+1, importRow{Req: m[2]})
+		if m[1] != " " && item.Status == importReady {
+			item.Status = importSkipped
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// handleImportTasks 处理 POST /api/tasks/import，请求体为文件原文
+// 查询参数：format 文件格式（不传时根据 filename 扩展名、Content-Type 或内容判断），filename 原文件名，
+// dryRun=true 只解析和校验不导入，sessionId 只投递给指定的MCP会话
+// 导入是原子的：任一条目校验失败或队列放不下时一条都不导入
+func handleImportTasks(w http.ResponseWriter, r *http.Request) {
+	debugLog("🌐 [HTTP] %s %s | 批量导入任务", r.Method, r.URL.Path)
+
+	query := r.URL.Query()
+	dryRun, _ := strconv.ParseBool(query.Get("dryRun"))
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBytes))
+	if err != nil {
+		debugLog("❌ [HTTP] 读取导入文件失败 | %v", err)
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, err := detectImportFormat(query.Get("format"), query.Get("filename"), r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items, err := parseImport(format, body)
+	if err != nil {
+		debugLog("❌ [HTTP] 导入文件解析失败 | 格式: %s | %v", format, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report := importReport{Format: format, DryRun: dryRun, Total: len(items), Items: items}
+	pending := make([]int, 0, len(items))
+	for i, item := range items {
+		switch item.Status {
+		case importInvalid:
+			report.Invalid++
+		case importSkipped:
+			report.Skipped++
+		default:
+			pending = append(pending, i)
+		}
+	}
+	report.Valid = report.Invalid == 0
+	if report.Valid && len(pending) == 0 {
+		report.Valid = false
+		report.Error = "no tasks to import"
+	}
+
+	status := http.StatusOK
+	switch {
+	case dryRun:
+	case !report.Valid:
+		if report.Error == "" {
+			report.Error = fmt.Sprintf("%d invalid item(s), nothing imported", report.Invalid)
+		}
+		status = http.StatusBadRequest
+	default:
+		sessionId := query.Get("sessionId")
+		resps := make([]UserChoiceResponse, 0, len(pending))
+		for _, i := range pending {
+			resps = append(resps, UserChoiceResponse{
+				CustomInput:   items[i].Req,
+				Continue:      items[i].Continue,
+				SelectedIndex: -1,
+				SessionId:     sessionId,
+				Channel:       channelImport,
+				Priority:      items[i].Priority,
+				Pinned:        items[i].Pinned,
+			})
+		}
+		taskIds, err := globalSessionManager.PushResponses(resps)
+		if err != nil {
+			// 队列放不下时一条都不导入，由调用方稍后重试或拆分文件
+			report.Error = fmt.Sprintf("%v: %d task(s) do not fit, nothing imported", err, len(resps))
+			w.Header().Set("Retry-After", "5")
+			status = http.StatusServiceUnavailable
+			break
+		}
+		for n, i := range pending {
+			items[i].Status = importImported
+			items[i].TaskId = taskIds[n]
+		}
+		report.Imported = len(taskIds)
+	}
+	debugLog("📥 [HTTP] 批量导入任务 | 格式: %s | 预览: %t | 总数: %d | 导入: %d | 跳过: %d | 无效: %d",
+		format, dryRun, report.Total, report.Imported, report.Skipped, report.Invalid)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestDetectImportFormat(t *testing.T) {
+	cases := []struct {
+		format, filename, contentType, body string
+		want                                string
+	}{
+		{"md", "", "", "", importMarkdown},
+		{"", "tasks_2024-01-01.csv", "", "", importCSV},
+		{"", "", "application/x-ndjson; charset=utf-8", "", importJSONL},
+		{"", "", "", `{"tasks": []}`, importJSON},
+		{"", "", "", "{\"req\": \"a\"}\n{\"req\": \"b\"}", importJSONL},
+		{"", "", "", "# todo\n- [ ] a\n- [x] b", importMarkdown},
+	}
+	for _, c := range cases {
+		got, err := detectImportFormat(c.format, c.filename, c.contentType, []byte(c.body))
+		if err != nil || got != c.want {
+			t.Errorf("detectImportFormat(%q, %q, %q, %q) = %s, %v, want %s", c.format, c.filename, c.contentType, c.body, got, err, c.want)
+		}
+	}
+	if _, err := detectImportFormat("", "", "", []byte("just text")); err == nil {
+		t.Errorf("detectImportFormat of plain text succeeded, want an error")
+	}
+}
+
+func TestParseImportItems(t *testing.T) {
+	csvBody := "\xef\xbb\xbfreq,priority,pinned,continue\nfirst,2,true,\n,0,false,\nthird,high,false,\nfourth,0,false,false\n"
+	items, err := parseImport(importCSV, []byte(csvBody))
+	if err != nil {
+		t.Fatalf("parseImport: %v", err)
+	}
+	want := []struct {
+		status string
+		line   int
+	}{{importReady, 2}, {importInvalid, 3}, {importInvalid, 4}, {importReady, 5}}
+	if len(items) != len(want) {
+		t.Fatalf("items = %+v, want %d items", items, len(want))
+	}
+	for i, w := range want {
+		if items[i].Status != w.status || items[i].Line != w.line {
+			t.Errorf("item %d = %s at line %d, want %s at line %d", i, items[i].Status, items[i].Line, w.status, w.line)
+		}
+	}
+	if items[0].Priority != 2 || !items[0].Pinned || !items[0].Continue {
+		t.Errorf("item 0 = %+v, want priority 2, pinned, continue", items[0])
+	}
+	if items[3].Continue {
+		t.Errorf("item 3 continues, want continue=false")
+	}
+
+	// 清单中已勾选的任务跳过，其他行忽略
+	items, _ = parseImport(importMarkdown, []byte("# todo\n\n- [ ] a\nnote\n1. [x] b\n"))
+	if len(items) != 2 || items[0].Status != importReady || items[1].Status != importSkipped || items[1].Line != 5 {
+		t.Errorf("markdown items = %+v, want a ready and b skipped at line 5", items)
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+var (
+	errTemplateExists   = errors.New("template already exists")
+	errTemplateNotFound = errors.New("template not found")
+	errSessionNotFound  = errors.New("session not found")
+	errTaskNotFound     = errors.New("task not found")
+	errTaskNotPending   = errors.New("task has already been claimed")
+)
+
+// 默认模板的作用范围
+const (
+	templateScopeSession = "session" // 某个 MCP 会话领取的指令
+	templateScopeProject = "project" // 连接时携带 ?project= 的会话领取的指令
+)
+
+// PromptTemplate 模板库中的命名模板，变量与全局格式化模板相同
+type PromptTemplate struct {
+	Name        string    `json:"name"`
+	Format      string    `json:"format"`
+	Description string    `json:"description,omitempty"`
+	UpdatedAt   time.Time `json:"updatedAt,omitzero"`
+}
+
+// TemplateLibraryState 模板库的持久化内容
+// 会话的默认模板随会话结束失效，不做持久化
+type TemplateLibraryState struct {
+	Templates []PromptTemplate  `json:"templates"`
+	Projects  map[string]string `json:"projects,omitempty"` // 项目名 -> 默认模板名
+}
+
+// TemplateLibrary 服务端保存的命名模板，以及按会话、项目选择的默认模板
+// AI领取指令时依次使用：任务指定的模板 → 会话默认模板 → 项目默认模板 → 全局格式化模板
+type TemplateLibrary struct {
+	mu        sync.RWMutex
+	templates map[string]PromptTemplate
+	parsed    map[string]*template.Template
+	projects  map[string]string // 项目名 -> 默认模板名
+	sessions  map[string]string // 会话ID -> 默认模板名
+	store     Store             // 持久化存储，所有变更写穿
+}
+
+// 全局模板库，启动时由 SessionManager.Restore 恢复
+var globalTemplates = NewTemplateLibrary()
+
+func NewTemplateLibrary() *TemplateLibrary {
+	return &TemplateLibrary{
+		templates: make(map[string]PromptTemplate),
+		parsed:    make(map[string]*template.Template),
+		projects:  make(map[string]string),
+		sessions:  make(map[string]string),
+		store:     memoryStore{},
+	}
+}
+
+// Restore 从存储中恢复模板库，无法解析的模板跳过
+func (l *TemplateLibrary) Restore(store Store, state *TemplateLibraryState) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.store = store
+	if state == nil {
+		return
+	}
+	for _, t := range state.Templates {
+		tmpl, err := parsePrompt(t.Format)
+		if err != nil {
+			debugLog("⚠️  [Templates] 跳过无效的模板 | 模板: %s | %v", t.Name, err)
+			continue
+		}
+		l.templates[t.Name] = t
+		l.parsed[t.Name] = tmpl
+	}
+	for project, name := range state.Projects {
+		l.projects[project] = name
+	}
+	debugLog("🧩 [Templates] 模板库已恢复 | 模板: %d | 项目默认模板: %d", len(l.templates), len(l.projects))
+}
+
+// persist 把模板库写入存储并通知页面（调用方需持有锁）
+func (l *TemplateLibrary) persist() {
+	if err := l.store.SaveTemplates(l.state()); err != nil {
+		debugLog("❌ [Templates] 持久化模板库失败 | %v", err)
+	}
+	globalEvents.Publish(EventTemplatesChanged, map[string]int{"templates": len(l.templates)})
+}
+
+// state 返回按名称排序的模板和项目默认模板（调用方需持有锁）
+func (l *TemplateLibrary) state() TemplateLibraryState {
+	state := TemplateLibraryState{
+		Templates: make([]PromptTemplate, 0, len(l.templates)),
+		Projects:  make(map[string]string, len(l.projects)),
+	}
+	for _, t := range l.templates {
+		state.Templates = append(state.Templates, t)
+	}
+	sort.Slice(state.Templates, func(i, j int) bool { return state.Templates[i].Name < state.Templates[j].Name })
+	for project, name := range l.projects {
+		state.Projects[project] = name
+	}
+	return state
+}
+
+// validateTemplate 校验模板名称和内容，返回解析好的模板
+func validateTemplate(t PromptTemplate) (*template.Template, error) {
+	switch {
+	case strings.TrimSpace(t.Name) == "":
+		return nil, fmt.Errorf("模板名称不能为空")
+	case len([]rune(t.Name)) > 64:
+		return nil, fmt.Errorf("模板名称不能超过 64 个字符")
+	case strings.Contains(t.Name, "/"):
+		return nil, fmt.Errorf("模板名称不能包含 /")
+	}
+	return parsePrompt(t.Format)
+}
+
+// List 返回所有模板
+func (l *TemplateLibrary) List() []PromptTemplate {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.state().Templates
+}
+
+// Get 按名称获取模板
+func (l *TemplateLibrary) Get(name string) (PromptTemplate, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	t, ok := l.templates[name]
+	return t, ok
+}
+
+// Has 模板是否存在
+func (l *TemplateLibrary) Has(name string) bool {
+	_, ok := l.Get(name)
+	return ok
+}
+
+// Save 新建或覆盖模板，create 为 true 时同名模板已存在返回 errTemplateExists，为 false 时不存在返回 errTemplateNotFound
+func (l *TemplateLibrary) Save(t PromptTemplate, create bool) (PromptTemplate, error) {
+	tmpl, err := validateTemplate(t)
+	if err != nil {
+		return PromptTemplate{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, exists := l.templates[t.Name]
+	if create && exists {
+		return PromptTemplate{}, errTemplateExists
+	}
+	if !create && !exists {
+		return PromptTemplate{}, errTemplateNotFound
+	}
+	t.UpdatedAt = time.Now()
+	l.templates[t.Name] = t
+	l.parsed[t.Name] = tmpl
+	l.persist()
+	debugLog("🧩 [Templates] 模板已保存 | 模板: %s | 内容: %s", t.Name, t.Format)
+	return t, nil
+}
+
+// Delete 删除模板，并清除引用它的默认模板；已指定该模板的任务领取时回退到默认模板
+func (l *TemplateLibrary) Delete(name string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.templates[name]; !ok {
+		return false
+	}
+	delete(l.templates, name)
+	delete(l.parsed, name)
+	for project, n := range l.projects {
+		if n == name {
+			delete(l.projects, project)
+		}
+	}
+	for session, n := range l.sessions {
+		if n == name {
+			delete(l.sessions, session)
+		}
+	}
+	l.persist()
+	debugLog("🗑️  [Templates] 模板已删除 | 模板: %s", name)
+	return true
+}
+
+// SetDefault 设置会话或项目的默认模板，name 为空时清除
+func (l *TemplateLibrary) SetDefault(scope, key, name string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if name != "" {
+		if _, ok := l.templates[name]; !ok {
+			return errTemplateNotFound
+		}
+	}
+
+	var defaults map[string]string
+	switch scope {
+	case templateScopeSession:
+		if _, ok := sessionConnections.Load(key); !ok {
+			return errSessionNotFound
+		}
+		defaults = l.sessions
+	case templateScopeProject:
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("项目名称不能为空")
+		}
+		defaults = l.projects
+	default:
+		return fmt.Errorf("scope 不支持 %q（可选 session | project）", scope)
+	}
+
+	if name == "" {
+		delete(defaults, key)
+	} else {
+		defaults[key] = name
+	}
+	l.persist()
+	debugLog("🧩 [Templates] 默认模板已设置 | 范围: %s | %s -> %s", scope, key, name)
+	return nil
+}
+
+// ClearSession 会话结束时清除它的默认模板
+func (l *TemplateLibrary) ClearSession(sessionId string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.sessions[sessionId]; ok {
+		delete(l.sessions, sessionId)
+		globalEvents.Publish(EventTemplatesChanged, map[string]int{"templates": len(l.templates)})
+	}
+}
+
+// Render 为领取指令的会话选择模板并渲染：任务指定的模板 → 会话默认模板 → 项目默认模板 → 全局格式化模板
+// 指定的模板已被删除时跳过，继续按后面的顺序选择
+func (l *TemplateLibrary) Render(name, sessionId string, data PromptData) string {
+	candidates := []string{name}
+	l.mu.RLock()
+	candidates = append(candidates, l.sessions[sessionId])
+	if project := sessionConnection(sessionId).Project; project != "" {
+		candidates = append(candidates, l.projects[project])
+	}
+	var tmpl *template.Template
+	for _, c := range candidates {
+		if c == "" {
+			continue
+		}
+		if tmpl = l.parsed[c]; tmpl != nil {
+			name = c
+			break
+		}
+		debugLog("⚠️  [Templates] 模板不存在，跳过 | TaskID: %s | 模板: %s", data.TaskId, c)
+	}
+	l.mu.RUnlock()
+
+	if tmpl == nil {
+		return globalPrompt.Render(data)
+	}
+	debugLog("🧩 [Templates] 使用模板格式化指令 | TaskID: %s | 会话: %s | 模板: %s", data.TaskId, sessionId, name)
+	return renderPrompt(tmpl, data)
+}
+
+// handleListTemplates 处理 GET /api/templates，返回模板、默认模板和当前连接的会话
+func handleListTemplates(w http.ResponseWriter, r *http.Request) {
+	globalTemplates.mu.RLock()
+	state := globalTemplates.state()
+	sessions := make(map[string]string, len(globalTemplates.sessions))
+	for id, name := range globalTemplates.sessions {
+		sessions[id] = name
+	}
+	globalTemplates.mu.RUnlock()
+
+	type activeSession struct {
+		SessionId string `json:"sessionId"`
+		connectionInfo
+	}
+	active := make([]activeSession, 0)
+	sessionConnections.Range(func(key, value any) bool {
+		active = append(active, activeSession{SessionId: key.(string), connectionInfo: value.(connectionInfo)})
+		return true
+	})
+	sort.Slice(active, func(i, j int) bool { return active[i].SessionId < active[j].SessionId })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"templates":      state.Templates,
+		"projects":       state.Projects,
+		"sessions":       sessions,
+		"activeSessions": active,
+	})
+}
+
+// handleGetTemplate 处理 GET /api/templates/{name}
+func handleGetTemplate(w http.ResponseWriter, r *http.Request) {
+	t, ok := globalTemplates.Get(r.PathValue("name"))
+	if !ok {
+		http.Error(w, errTemplateNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// handleCreateTemplate 处理 POST /api/templates，同名模板已存在时返回 409
+func handleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	debugLog("🌐 [HTTP] %s %s | 新建模板", r.Method, r.URL.Path)
+	var t PromptTemplate
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	saveTemplate(w, t, true)
+}
+
+// handleUpdateTemplate 处理 PUT /api/templates/{name}，修改模板内容和说明
+func handleUpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	debugLog("🌐 [HTTP] %s %s | 修改模板", r.Method, r.URL.Path)
+	var t PromptTemplate
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	t.Name = r.PathValue("name")
+	saveTemplate(w, t, false)
+}
+
+func saveTemplate(w http.ResponseWriter, t PromptTemplate, create bool) {
+	saved, err := globalTemplates.Save(t, create)
+	switch {
+	case errors.Is(err, errTemplateExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, errTemplateNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if create {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(saved)
+}
+
+// handleDeleteTemplate 处理 DELETE /api/templates/{name}
+func handleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	debugLog("🌐 [HTTP] %s %s | 删除模板", r.Method, r.URL.Path)
+	if !globalTemplates.Delete(r.PathValue("name")) {
+		http.Error(w, errTemplateNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"message": "Template deleted",
+	})
+}
+
+// handleSetDefaultTemplate 处理 POST /api/templates/defaults，设置或清除会话、项目的默认模板
+// 请求体 {"scope": "session" | "project", "key": "<会话ID或项目名>", "template": "<模板名，为空时清除>"}
+func handleSetDefaultTemplate(w http.ResponseWriter, r *http.Request) {
+	debugLog("🌐 [HTTP] %s %s | 设置默认模板", r.Method, r.URL.Path)
+	var req struct {
+		Scope    string `json:"scope"`
+		Key      string `json:"key"`
+		Template string `json:"template"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	err := globalTemplates.SetDefault(req.Scope, req.Key, req.Template)
+	switch {
+	case errors.Is(err, errTemplateNotFound), errors.Is(err, errSessionNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"message": "Default template updated",
+	})
+}
+
+// handleTaskTemplate 处理 POST /api/tasks/{id}/template，为还在排队的任务指定模板，template 为空时取消指定
+func handleTaskTemplate(w http.ResponseWriter, r *http.Request) {
+	debugLog("🌐 [HTTP] %s %s | 指定任务模板", r.Method, r.URL.Path)
+	var req struct {
+		Template string `json:"template"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Template != "" && !globalTemplates.Has(req.Template) {
+		http.Error(w, errTemplateNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	task, err := globalSessionManager.Taskmng.SetTemplate(r.PathValue("id"), req.Template)
+	switch {
+	case errors.Is(err, errTaskNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, errTaskNotPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
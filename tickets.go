@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 渲染任务类型：human_ask 创建的异步提问
+const renderKindAsk = "ask"
+
+// 异步提问的状态
+const (
+	ticketPending   = "pending"   // 等待用户回答
+	ticketAnswered  = "answered"  // 用户已回答
+	ticketAbandoned = "abandoned" // 用户在页面上遗弃了该提问
+	ticketExpired   = "expired"   // 超过有效期仍未回答
+)
+
+// 已关闭的异步提问的保留时长，超过后从内存和存储中移除，human_check 返回不存在
+const (
+	ticketRetention          = 24 * time.Hour   // 关闭后一直没有被 human_check 取走
+	ticketDeliveredRetention = 10 * time.Minute // 已经被 human_check 取走，留出重复查询的时间
+)
+
+// Ticket human_ask 创建的异步提问
+type Ticket struct {
+	Id          string              // 提问ID，与渲染任务ID相同
+	Status      string              // pending | answered | abandoned | expired
+	Question    RenderTask          // 展示给用户的渲染任务
+	Response    *UserChoiceResponse // 用户的回答
+	ClosedAt    time.Time           // 回答、遗弃或过期的时间
+	deliveredAt time.Time           // 关闭后第一次通过 human_check 交给AI的时间
+}
+
+// stale 已关闭的提问是否超过了保留时长
+func (t *Ticket) stale(now time.Time) bool {
+	switch {
+	case t.Status == ticketPending:
+		return false
+	case !t.deliveredAt.IsZero():
+		return now.Sub(t.deliveredAt) > ticketDeliveredRetention
+	default:
+		return now.Sub(t.ClosedAt) > ticketRetention
+	}
+}
+
+// TicketRecord 持久化的已遗弃或已过期的异步提问，已回答的提问由历史响应恢复
+type TicketRecord struct {
+	Id          string     `json:"id"`
+	Status      string     `json:"status"`
+	Question    RenderTask `json:"question"`
+	ClosedAt    time.Time  `json:"closedAt"`
+	DeliveredAt time.Time  `json:"deliveredAt,omitzero"`
+}
+
+// TicketManager 管理异步提问
+// 用户的回答通过 SessionManager.deliver 投递到这里，而不是等待中的工具调用
+type TicketManager struct {
+	mu      sync.Mutex
+	tickets map[string]*Ticket
+	store   Store // 持久化存储，只记录已遗弃和已过期的提问
+}
+
+func NewTicketManager() *TicketManager {
+	return &TicketManager{tickets: make(map[string]*Ticket), store: memoryStore{}}
+}
+
+// 全局异步提问管理器
+var globalTickets = NewTicketManager()
+
+// Open 创建异步提问并展示到页面上，同时清理超过保留时长的已关闭提问
+func (tm *TicketManager) Open(task RenderTask) {
+	tm.mu.Lock()
+	tm.prune(time.Now())
+	tm.tickets[task.Id] = &Ticket{Id: task.Id, Status: ticketPending, Question: task}
+	tm.mu.Unlock()
+
+	globalSessionManager.AddRenderTask(task)
+	tm.scheduleExpiry(task)
+	debugLog("🎫 [Tickets] 创建异步提问 | ID: %s | 摘要: %s | 过期时间: %v", task.Id, task.Summary, task.ExpiresAt)
+}
+
+// Restore 根据恢复的渲染任务、历史响应和已关闭的提问记录重建异步提问
+// 已回答的提问只能恢复回答，提问时间未知；超过保留时长的提问不再恢复
+func (tm *TicketManager) Restore(store Store, renderTasks []RenderTask, responses []UserChoiceResponse, records []TicketRecord) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.store = store
+
+	for _, task := range renderTasks {
+		if task.Kind != renderKindAsk {
+			continue
+		}
+		tm.tickets[task.Id] = &Ticket{Id: task.Id, Status: ticketPending, Question: task}
+		tm.scheduleExpiry(task)
+	}
+	for _, rec := range records {
+		tm.tickets[rec.Id] = &Ticket{
+			Id:          rec.Id,
+			Status:      rec.Status,
+			Question:    rec.Question,
+			ClosedAt:    rec.ClosedAt,
+			deliveredAt: rec.DeliveredAt,
+		}
+	}
+	for i := range responses {
+		resp := responses[i]
+		if resp.TicketId == "" {
+			continue
+		}
+		resp = globalSessionManager.formatResponse(resp, resp.SessionId)
+		ticket := &Ticket{
+			Id:       resp.TicketId,
+			Status:   ticketAnswered,
+			Question: RenderTask{Id: resp.TicketId, Kind: renderKindAsk, SessionId: resp.SessionId},
+			Response: &resp,
+			ClosedAt: resp.AnsweredAt,
+		}
+		// 任务仍是 pending 说明重启前回答还没有被 human_check 取走，第一次取走时仍要领取任务
+		// 已经取走的回答不知道取走的时间，按回答时间计算保留时长
+		if task, ok := globalSessionManager.Taskmng.SnapshotTask(resp.TaskId); !ok || task.Status != "pending" {
+			ticket.deliveredAt = resp.AnsweredAt
+		}
+		tm.tickets[resp.TicketId] = ticket
+	}
+	tm.prune(time.Now())
+}
+
+// prune 移除超过保留时长的已关闭提问（调用方需持有锁）
+func (tm *TicketManager) prune(now time.Time) {
+	for id, ticket := range tm.tickets {
+		if !ticket.stale(now) {
+			continue
+		}
+		delete(tm.tickets, id)
+		if ticket.Status != ticketAnswered {
+			if err := tm.store.DeleteTicket(id); err != nil {
+				debugLog("❌ [Tickets] 删除异步提问记录失败 | ID: %s | %v", id, err)
+			}
+		}
+		debugLog("🧹 [Tickets] 移除已关闭的异步提问 | ID: %s | 状态: %s", id, ticket.Status)
+	}
+}
+
+// persist 把已遗弃或已过期的提问写入存储（调用方需持有锁）
+func (tm *TicketManager) persist(ticket *Ticket) {
+	err := tm.store.SaveTicket(TicketRecord{
+		Id:          ticket.Id,
+		Status:      ticket.Status,
+		Question:    ticket.Question,
+		ClosedAt:    ticket.ClosedAt,
+		DeliveredAt: ticket.deliveredAt,
+	})
+	if err != nil {
+		debugLog("❌ [Tickets] 持久化异步提问失败 | ID: %s | %v", ticket.Id, err)
+	}
+}
+
+// scheduleExpiry 到期后把仍未回答的提问标记为过期，并从页面上移除
+func (tm *TicketManager) scheduleExpiry(task RenderTask) {
+	if task.ExpiresAt.IsZero() {
+		return
+	}
+	time.AfterFunc(time.Until(task.ExpiresAt), func() {
+		// 与回答、遗弃竞争时以移除渲染任务的一方为准
+		if globalSessionManager.RemoveRenderTask(task.Id) {
+			tm.close(task.Id, ticketExpired)
+		}
+	})
+}
+
+// answer 记录用户的回答，回答本身作为历史响应持久化
+func (tm *TicketManager) answer(resp UserChoiceResponse) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	ticket, ok := tm.tickets[resp.TicketId]
+	if !ok || ticket.Status != ticketPending {
+		debugLog("⚠️  [Tickets] 异步提问不存在或已关闭，忽略回答 | ID: %s", resp.TicketId)
+		return
+	}
+	resp = globalSessionManager.formatResponse(resp, ticket.Question.SessionId)
+	ticket.Status = ticketAnswered
+	ticket.Response = &resp
+	ticket.ClosedAt = time.Now()
+	debugLog("🎫 [Tickets] 异步提问已回答 | ID: %s | TaskID: %s", ticket.Id, resp.TaskId)
+}
+
+// Abandon 用户在页面上遗弃了渲染任务，不是异步提问时忽略
+func (tm *TicketManager) Abandon(id string) {
+	tm.close(id, ticketAbandoned)
+}
+
+func (tm *TicketManager) close(id, status string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	ticket, ok := tm.tickets[id]
+	if !ok || ticket.Status != ticketPending {
+		return
+	}
+	ticket.Status = status
+	ticket.ClosedAt = time.Now()
+	tm.persist(ticket)
+	debugLog("🎫 [Tickets] 异步提问已关闭 | ID: %s | 状态: %s", id, status)
+}
+
+// Check 查询异步提问，返回副本，超过保留时长的已关闭提问视为不存在
+// 回答第一次被取走时把对应任务标记为 processing，与 human_interaction 收到回答时一致
+func (tm *TicketManager) Check(id string) (Ticket, bool) {
+	now := time.Now()
+	tm.mu.Lock()
+	tm.prune(now)
+	ticket, ok := tm.tickets[id]
+	if !ok {
+		tm.mu.Unlock()
+		return Ticket{}, false
+	}
+	firstDelivery := ticket.Status != ticketPending && ticket.deliveredAt.IsZero()
+	if firstDelivery {
+		ticket.deliveredAt = now
+		if ticket.Status != ticketAnswered {
+			tm.persist(ticket)
+		}
+	}
+	snapshot := *ticket
+	tm.mu.Unlock()
+
+	if firstDelivery && snapshot.Status == ticketAnswered && snapshot.Response.Continue {
+		globalSessionManager.Taskmng.ClaimTask(snapshot.Response.TaskId, snapshot.Question.SessionId, snapshot.Response.CustomInput, snapshot.Question.Summary)
+	}
+	return snapshot, true
+}
+
+// TicketResult human_ask / human_check 的结构化返回结果
+type TicketResult struct {
+	TicketId  string                  `json:"ticketId" jsonschema_description:"异步提问ID，通过 human_check 查询回答"`
+	Status    string                  `json:"status" jsonschema:"enum=pending,enum=answered,enum=abandoned,enum=expired" jsonschema_description:"pending 等待回答；answered 已回答，见 answer；abandoned 用户放弃回答；expired 超过有效期未回答"`
+	CreatedAt time.Time               `json:"createdAt,omitzero" jsonschema_description:"提问时间，服务重启前已回答的提问不返回"`
+	ExpiresAt time.Time               `json:"expiresAt,omitzero" jsonschema_description:"过期时间，没有设置有效期时不返回"`
+	ClosedAt  time.Time               `json:"closedAt,omitzero" jsonschema_description:"回答、遗弃或过期的时间"`
+	Answer    *HumanInteractionResult `json:"answer,omitempty" jsonschema_description:"用户的回答，只在 answered 时返回"`
+}
+
+func newTicketResult(ticket Ticket) TicketResult {
+	result := TicketResult{
+		TicketId:  ticket.Id,
+		Status:    ticket.Status,
+		CreatedAt: ticket.Question.CreatedAt,
+		ExpiresAt: ticket.Question.ExpiresAt,
+		ClosedAt:  ticket.ClosedAt,
+	}
+	if ticket.Response != nil {
+		answer := newInteractionResult(ticket.Question, *ticket.Response)
+		answer.WaitedMs = 0
+		if !ticket.Question.CreatedAt.IsZero() {
+			answer.WaitedMs = ticket.ClosedAt.Sub(ticket.Question.CreatedAt).Milliseconds()
+		}
+		result.Answer = &answer
+	}
+	return result
+}
+
+// HumanAskTool 定义非阻塞的提问工具，说明文案使用指定语言
+func HumanAskTool(locale string) mcp.Tool {
+	desc := func(key string) string { return globalI18n.Tool(locale, "human_ask."+key) }
+	return mcp.NewTool(
+		"human_ask",
+		mcp.WithDescription(globalI18n.Tool(locale, "human_ask")),
+		mcp.WithString("summary", mcp.Required(), mcp.Description(desc("summary"))),
+		mcp.WithString("difficulties", mcp.Description(desc("difficulties"))),
+		mcp.WithArray("nextOptions", mcp.Items(nextOptionsSchema(locale)),
+			mcp.Description(desc("nextOptions"))),
+		mcp.WithString("taskId", mcp.Description(desc("taskId"))),
+		mcp.WithNumber("expiresInSeconds", mcp.Description(desc("expiresInSeconds"))),
+		mcp.WithOutputSchema[TicketResult](),
+	)
+}
+
+// HumanCheckTool 定义查询异步提问回答的工具，说明文案使用指定语言
+func HumanCheckTool(locale string) mcp.Tool {
+	return mcp.NewTool(
+		"human_check",
+		mcp.WithDescription(globalI18n.Tool(locale, "human_check")),
+		mcp.WithString("ticketId", mcp.Required(), mcp.Description(globalI18n.Tool(locale, "human_check.ticketId"))),
+		mcp.WithOutputSchema[TicketResult](),
+	)
+}
+
+// humanAskHandler 创建异步提问，立即返回 ticketId
+func humanAskHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	summary, err := req.RequireString("summary")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	nextOptions, err := parseNextOptions(req.GetArguments()["nextOptions"])
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := process(globalSessionManager, localeFromContext(ctx), req.GetString("taskId", ""), summary); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	task := RenderTask{
+		Id:           uuid.NewString(),
+		Kind:         renderKindAsk,
+		NextOptions:  nextOptions,
+		Summary:      summary,
+		Difficulties: req.GetString("difficulties", ""),
+		SessionId:    sessionIdFromContext(ctx),
+		CreatedAt:    time.Now(),
+	}
+	if secs := req.GetFloat("expiresInSeconds", 0); secs > 0 {
+		task.ExpiresAt = task.CreatedAt.Add(time.Duration(secs * float64(time.Second)))
+	}
+	globalTickets.Open(task)
+
+	result := TicketResult{TicketId: task.Id, Status: ticketPending, CreatedAt: task.CreatedAt, ExpiresAt: task.ExpiresAt}
+	text := globalI18n.Prompt(localeFromContext(ctx), "ask_opened", InstructionData{TicketId: task.Id})
+	return mcp.NewToolResultStructured(result, text), nil
+}
+
+// humanCheckHandler 查询异步提问的状态和回答
+func humanCheckHandler(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, err := req.RequireString("ticketId")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	locale := localeFromContext(ctx)
+	ticket, ok := globalTickets.Check(id)
+	if !ok {
+		return mcp.NewToolResultError(globalI18n.Prompt(locale, "check_not_found", InstructionData{TicketId: id})), nil
+	}
+	debugLog("🎫 [Tickets] 查询异步提问 | ID: %s | 状态: %s", id, ticket.Status)
+
+	result := newTicketResult(ticket)
+	var name string
+	var data InstructionData
+	switch ticket.Status {
+	case ticketPending:
+		name = "check_pending"
+	case ticketAnswered:
+		if result.Answer.Continue {
+			name = "check_answered"
+			data = InstructionData{Instruction: result.Answer.Instruction, TaskId: result.Answer.TaskId}
+		} else {
+			name = "check_stopped"
+		}
+	case ticketAbandoned:
+		name = "check_abandoned"
+	case ticketExpired:
+		name = "check_expired"
+	}
+	text := globalI18n.Prompt(locale, name, data)
+	body, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultStructured(result, text+"\n\n---\n\n"+string(body)), nil
+}
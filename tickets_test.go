@@ -0,0 +1,111 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTicket 创建一个异步提问
+func openTicket(id string) {
+	globalTickets.Open(RenderTask{Id: id, Kind: renderKindAsk, Summary: "summary " + id, CreatedAt: time.Now()})
+}
+
+func TestTicketAnswerDeliveredOnceAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+	sm := restart(t, path)
+	openTicket("ask-1")
+	taskId, _, err := answerRenderTask(renderSelectRequest{RenderTaskId: "ask-1", CustomInput: "go on", Continue: true}, channelWeb)
+	if err != nil {
+		t.Fatalf("answerRenderTask: %v", err)
+	}
+	// 回答交给 TicketManager，不进入响应队列
+	if n := sm.Out.Len(); n != 0 {
+		t.Errorf("queued = %d, want 0", n)
+	}
+
+	// 重启前回答还没有被取走，重启后第一次 human_check 领取任务
+	sm = restart(t, path)
+	if n := sm.Out.Len(); n != 0 {
+		t.Errorf("queued after restart = %d, want 0", n)
+	}
+	if task, _ := sm.Taskmng.SnapshotTask(taskId); task.Status != "pending" {
+		t.Fatalf("task before first check = %s, want pending", task.Status)
+	}
+	ticket, ok := globalTickets.Check("ask-1")
+	if !ok || ticket.Status != ticketAnswered || ticket.Response == nil || ticket.Response.TaskId != taskId {
+		t.Fatalf("Check = %+v, %v, want the answer for %s", ticket, ok, taskId)
+	}
+	if task, _ := sm.Taskmng.SnapshotTask(taskId); task.Status != "processing" {
+		t.Errorf("task after first check = %s, want processing", task.Status)
+	}
+
+	// 已领取的任务再次重启后不会被当作未取走的回答
+	sm.Taskmng.UpdateTask(taskId, "completed", "done")
+	sm = restart(t, path)
+	if ticket, ok := globalTickets.Check("ask-1"); !ok || ticket.Status != ticketAnswered {
+		t.Errorf("Check after second restart = %+v, %v, want answered", ticket, ok)
+	}
+	if task, _ := sm.Taskmng.SnapshotTask(taskId); task.Status != "completed" {
+		t.Errorf("task after second restart = %s, want completed", task.Status)
+	}
+}
+
+func TestClosedTicketsSurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.jsonl")
+	sm := restart(t, path)
+	openTicket("ask-abandoned")
+	openTicket("ask-expired")
+	openTicket("ask-pending")
+	sm.RemoveRenderTask("ask-abandoned")
+	globalTickets.Abandon("ask-abandoned")
+	sm.RemoveRenderTask("ask-expired")
+	globalTickets.close("ask-expired", ticketExpired)
+
+	sm = restart(t, path)
+	want := map[string]string{
+		"ask-abandoned": ticketAbandoned,
+		"ask-expired":   ticketExpired,
+		"ask-pending":   ticketPending,
+	}
+	for id, status := range want {
+		ticket, ok := globalTickets.Check(id)
+		if !ok || ticket.Status != status {
+			t.Errorf("Check(%s) = %s, %v, want %s", id, ticket.Status, ok, status)
+		}
+	}
+	if tasks := sm.GetRenderTasks(); len(tasks) != 1 || tasks[0].Id != "ask-pending" {
+		t.Errorf("render tasks after restart = %+v, want only ask-pending", tasks)
+	}
+
+	// 第一次取走的时间也会持久化，重启后按较短的保留时长计算
+	restart(t, path)
+	ticket, _ := globalTickets.Check("ask-abandoned")
+	if ticket.deliveredAt.IsZero() {
+		t.Errorf("delivery time of ask-abandoned lost after restart")
+	}
+}
+
+func TestTicketPrune(t *testing.T) {
+	now := time.Now()
+	tm := NewTicketManager()
+	tm.tickets = map[string]*Ticket{
+		"pending":         {Id: "pending", Status: ticketPending},
+		"closed":          {Id: "closed", Status: ticketAbandoned, ClosedAt: now.Add(-time.Hour)},
+		"closed-stale":    {Id: "closed-stale", Status: ticketExpired, ClosedAt: now.Add(-ticketRetention - time.Minute)},
+		"delivered":       {Id: "delivered", Status: ticketAnswered, ClosedAt: now.Add(-time.Hour), deliveredAt: now.Add(-time.Minute)},
+		"delivered-stale": {Id: "delivered-stale", Status: ticketAnswered, ClosedAt: now.Add(-time.Hour), deliveredAt: now.Add(-ticketDeliveredRetention - time.Minute)},
+	}
+	tm.prune(now)
+
+	for _, id := range []string{"pending", "closed", "delivered"} {
+		if _, ok := tm.tickets[id]; !ok {
+			t.Errorf("%s pruned, want kept", id)
+		}
+	}
+	for _, id := range []string{"closed-stale", "delivered-stale"} {
+		if _, ok := tm.tickets[id]; ok {
+			t.Errorf("%s kept, want pruned", id)
+		}
+	}
+}
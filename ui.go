@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 编译进二进制的任务管理页面资源
+//
+//go:embed templates
+var embeddedUI embed.FS
+
+// uiHandler 提供任务管理页面及其静态资源
+// 默认使用内嵌资源并带 ETag 缓存校验；指定 ui_dir 时直接读取磁盘文件，不缓存，便于本地开发
+type uiHandler struct {
+	files fs.FS
+	dev   bool
+	etags map[string]string // 内嵌资源的 ETag，启动时计算一次
+}
+
+// newUIHandler 创建页面处理器，uiDir 为空时使用内嵌资源
+func newUIHandler(uiDir string) *uiHandler {
+	if uiDir != "" {
+		return &uiHandler{files: os.DirFS(uiDir), dev: true}
+	}
+
+	files, _ := fs.Sub(embeddedUI, "templates")
+	h := &uiHandler{files: files, etags: make(map[string]string)}
+	fs.WalkDir(files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		h.etags[name] = `"` + hex.EncodeToString(sum[:8]) + `"`
+		return nil
+	})
+	return h
+}
+
+func (h *uiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+	if name == "" {
+		name = "index.html"
+	}
+	// 服务端模板（如登录页）由 authManager 渲染，不直接对外提供
+	if path.Ext(name) == ".tmpl" {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := fs.ReadFile(h.files, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		debugLog("❌ [HTTP] 读取页面资源失败 | %s | %v", name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	w.Header().Set("Content-Type", contentType)
+
+	if h.dev {
+		w.Header().Set("Cache-Control", "no-store")
+	} else {
+		// 内容随二进制一起发布，每次使用前通过 ETag 校验
+		etag := h.etags[name]
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", etag)
+		if match := r.Header.Get("If-None-Match"); match != "" && match == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(data)
+}
+
+// watchUIDir 轮询 ui_dir 下文件的修改时间，变化时推送 ui-reload 事件让页面自动刷新
+func watchUIDir(uiDir string, interval time.Duration) {
+	last := latestModTime(uiDir)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		current := latestModTime(uiDir)
+		if current.After(last) {
+			last = current
+			debugLog("🔄 [UI] 页面资源已修改，通知页面刷新 | 目录: %s", uiDir)
+			globalEvents.Publish(EventUIReload, map[string]any{})
+		}
+	}
+}
+
+// latestModTime 返回目录下所有文件中最新的修改时间
+func latestModTime(dir string) time.Time {
+	var latest time.Time
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest
+}